@@ -0,0 +1,220 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ansibleEventPrefix starts the stderr lines carrying the events of the kraken_events callback.
+const ansibleEventPrefix string = "KRAKEN-EVENT "
+
+const ansibleEventsCallback string = "kraken_events"
+
+// ansibleEventsPlugin is a notification callback reporting plays, tasks and their results
+// as JSON lines on stderr, next to the regular output of ansible-playbook.
+const ansibleEventsPlugin string = `# Generated by kraken, changes are overwritten.
+from __future__ import (absolute_import, division, print_function)
+__metaclass__ = type
+
+import json
+import sys
+import time
+
+from ansible.plugins.callback import CallbackBase
+
+
+class CallbackModule(CallbackBase):
+    CALLBACK_VERSION = 2.0
+    CALLBACK_TYPE = 'notification'
+    CALLBACK_NAME = 'kraken_events'
+    CALLBACK_NEEDS_WHITELIST = True
+
+    def __init__(self, *args, **kwargs):
+        super(CallbackModule, self).__init__(*args, **kwargs)
+        self._play = ''
+
+    def _emit(self, event, **fields):
+        fields['event'] = event
+        fields['time'] = time.time()
+        sys.stderr.write('KRAKEN-EVENT ' + json.dumps(fields) + '\n')
+        sys.stderr.flush()
+
+    def v2_playbook_on_play_start(self, play):
+        self._play = play.get_name()
+        self._emit('play_start', play=self._play)
+
+    def v2_playbook_on_task_start(self, task, is_conditional):
+        role = task._role.get_name() if task._role else ''
+        self._emit('task_start', play=self._play, task=task.get_name(), role=role, tags=list(task.tags))
+
+    def v2_playbook_on_handler_task_start(self, task):
+        self.v2_playbook_on_task_start(task, False)
+
+    def _result(self, status, result):
+        fields = dict(play=self._play, task=result._task.get_name(), host=result._host.get_name(),
+                      status=status, changed=bool(result._result.get('changed', False)))
+        if status in ('failed', 'unreachable'):
+            fields['msg'] = str(result._result.get('msg', ''))
+            fields['stderr'] = str(result._result.get('stderr', ''))
+        self._emit('result', **fields)
+
+    def v2_runner_on_ok(self, result):
+        self._result('ok', result)
+
+    def v2_runner_on_failed(self, result, ignore_errors=False):
+        self._result('ignored' if ignore_errors else 'failed', result)
+
+    def v2_runner_on_unreachable(self, result):
+        self._result('unreachable', result)
+
+    def v2_runner_on_skipped(self, result):
+        self._result('skipped', result)
+
+    def v2_playbook_on_stats(self, stats):
+        self._emit('stats')
+`
+
+// ansibleEvent is one event of the kraken_events callback.
+type ansibleEvent struct {
+	Event   string   `json:"event"`
+	Time    float64  `json:"time"`
+	Play    string   `json:"play"`
+	Task    string   `json:"task"`
+	Role    string   `json:"role"`
+	Tags    []string `json:"tags"`
+	Host    string   `json:"host"`
+	Status  string   `json:"status"`
+	Changed bool     `json:"changed"`
+	Msg     string   `json:"msg"`
+	Stderr  string   `json:"stderr"`
+}
+
+// stage returns the kraken-lib stage a task_start event belongs to, from its role or tags.
+func (e *ansibleEvent) stage() string {
+	if stage := stageOfRole(e.Role); stage != "" {
+		return stage
+	}
+
+	for _, stage := range krakenStages {
+		for _, tag := range e.Tags {
+			if tag == stage {
+				return stage
+			}
+		}
+	}
+
+	return ""
+}
+
+// taskName strips the role from the name ansible gives tasks of roles.
+func (e *ansibleEvent) taskName() string {
+	if i := strings.Index(e.Task, " : "); i >= 0 {
+		return e.Task[i+3:]
+	}
+
+	return e.Task
+}
+
+// ansibleEventEnvironment installs the kraken_events callback plugin in the output folder,
+// which is mounted in the container, and returns the environment enabling it.
+func ansibleEventEnvironment() ([]string, error) {
+	pluginDir := filepath.Join(outputLocation, ".ansible", "callback_plugins")
+	if err := os.MkdirAll(pluginDir, 0755); err != nil {
+		return nil, err
+	}
+
+	pluginPath := filepath.Join(pluginDir, ansibleEventsCallback+".py")
+	if err := ioutil.WriteFile(pluginPath, []byte(ansibleEventsPlugin), 0644); err != nil {
+		return nil, err
+	}
+
+	return []string{
+		"ANSIBLE_CALLBACK_PLUGINS=" + pluginDir,
+		// ansible before 2.11 whitelists callbacks, later versions enable them
+		"ANSIBLE_CALLBACK_WHITELIST=" + ansibleEventsCallback,
+		"ANSIBLE_CALLBACKS_ENABLED=" + ansibleEventsCallback,
+	}, nil
+}
+
+// ansibleEventFilter passes everything written to it through to out, except event lines,
+// which are handed to handle instead.
+type ansibleEventFilter struct {
+	out     io.Writer
+	handle  func(ansibleEvent)
+	partial []byte
+}
+
+func (f *ansibleEventFilter) Write(p []byte) (int, error) {
+	f.partial = append(f.partial, p...)
+
+	for {
+		i := bytes.IndexByte(f.partial, '\n')
+		if i < 0 {
+			break
+		}
+
+		if err := f.writeLine(f.partial[:i+1]); err != nil {
+			return 0, err
+		}
+		f.partial = f.partial[i+1:]
+	}
+
+	// anything that cannot become an event line goes through right away, e.g. prompts
+	if len(f.partial) > 0 && !bytes.HasPrefix(f.partial, []byte(ansibleEventPrefix)) && !bytes.HasPrefix([]byte(ansibleEventPrefix), f.partial) {
+		if _, err := f.out.Write(f.partial); err != nil {
+			return 0, err
+		}
+		f.partial = nil
+	}
+
+	return len(p), nil
+}
+
+func (f *ansibleEventFilter) writeLine(line []byte) error {
+	if !bytes.HasPrefix(line, []byte(ansibleEventPrefix)) {
+		_, err := f.out.Write(line)
+		return err
+	}
+
+	var event ansibleEvent
+	if err := json.Unmarshal(bytes.TrimPrefix(line, []byte(ansibleEventPrefix)), &event); err != nil {
+		_, err := f.out.Write(line)
+		return err
+	}
+
+	if f.handle != nil {
+		f.handle(event)
+	}
+
+	return nil
+}
+
+// Flush writes out what is left of an unterminated last line.
+func (f *ansibleEventFilter) Flush() error {
+	if len(f.partial) == 0 {
+		return nil
+	}
+
+	err := f.writeLine(f.partial)
+	f.partial = nil
+	return err
+}
@@ -16,6 +16,7 @@ package cmd
 
 import (
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -23,6 +24,7 @@ import (
 var userName string
 var password string
 var configForced bool
+var lockWait time.Duration
 
 // clusterCmd represents the cluster command
 var clusterCmd = &cobra.Command{
@@ -62,5 +64,15 @@ func init() {
 		"u",
 		"",
 		"registry user name")
+	clusterCmd.PersistentFlags().DurationVar(
+		&lockWait,
+		"wait-for-lock",
+		0,
+		"how long to wait for another operation on the cluster to release its lock, e.g. 10m (default do not wait)")
+	clusterCmd.PersistentFlags().BoolVar(
+		&allowImageChange,
+		"allow-image-change",
+		false,
+		"run a kraken-lib image other than the one the cluster was created with, and pin it on success")
 
 }
@@ -0,0 +1,155 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/spf13/cobra"
+)
+
+// attachCmd represents the attach command
+var attachCmd = &cobra.Command{
+	Use:   "attach",
+	Short: "Attach to a running Kraken cluster operation",
+	Long: `Replays and follows the output of an up, down, update or ssh-refresh still running against
+	the Kraken cluster described in the specified configuration yaml, then reports its outcome`,
+	SilenceErrors: true,
+	SilenceUsage:  false,
+	PreRunE:       preRunGetClusterConfig,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clusterName := getFirstClusterName()
+
+		// we do not support any additional arguments, we error out then if there are.
+		if len(args) > 0 {
+			return fmt.Errorf("Unexpected argument(s) passed %v", args)
+		}
+
+		cmd.SilenceUsage = true
+
+		rt, err := newContainerRuntime()
+		if err != nil {
+			return err
+		}
+
+		action, statusCode, err := followClusterAction(rt, clusterName)
+		if err != nil {
+			return err
+		}
+
+		ExitCode = statusCode
+		helpType, ok := helpTypeForAction(action)
+		if !ok {
+			return nil
+		}
+
+		if statusCode != 0 {
+			clusterHelpError(helpType, ClusterConfigPath)
+		} else {
+			fmt.Println("Done.")
+			clusterHelp(helpType, ClusterConfigPath)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(attachCmd)
+}
+
+// followClusterAction replays and follows the output of the cluster action running for
+// clusterName, and returns the action and its exit code once it is done.
+func followClusterAction(rt ContainerRuntime, clusterName string) (string, int, error) {
+	info, err := findClusterContainer(rt, clusterName)
+	if err != nil {
+		return "", 0, err
+	}
+
+	action := info.Config.Labels[actionLabel]
+	fmt.Printf("Attaching to '%s' of cluster '%s', interrupt to detach (the operation keeps running) \n", action, clusterName)
+
+	ctx := getContext()
+	reader, err := rt.ContainerLogs(ctx, info.ID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+	if err != nil {
+		return action, 0, err
+	}
+
+	// the progress events of the original command are of no use here
+	events := &ansibleEventFilter{out: os.Stderr}
+	err = demuxLogs(reader, os.Stdout, events)
+	events.Flush()
+	Close(reader)
+	if err != nil {
+		return action, 0, err
+	}
+
+	statusCode, err := rt.ContainerWait(ctx, info.ID)
+	if err != nil {
+		return action, 0, err
+	}
+
+	// clean up as the original command would have, unless it is still around to do it
+	if !ownerCleansUp(info.Config.Labels, clusterName) {
+		containerRenameOrRemove(rt, types.ContainerCreateResponse{ID: info.ID}, clusterName, false, false)()
+	}
+
+	return action, statusCode, nil
+}
+
+// ownerCleansUp reports whether the kraken command that started a container is still
+// around to clean it up. Containers started before they were labelled with their owner
+// are left to the holder of the cluster lock, if any.
+func ownerCleansUp(labels map[string]string, clusterName string) bool {
+	if _, ok := labels[ownerPIDLabel]; ok {
+		return !ownerGone(labels)
+	}
+
+	holder, err := readClusterLock(clusterLockPath(clusterName))
+	return err == nil && !holder.isStale()
+}
+
+// findClusterContainer finds the running kraken-lib container of a cluster action (up, down,
+// update or ssh-refresh) by its labels, whatever its name: tool containers share the name
+// of the cluster, and renamed containers keep their labels.
+func findClusterContainer(rt ContainerRuntime, clusterName string) (types.ContainerJSON, error) {
+	ctx := getContext()
+
+	labels := filters.NewArgs()
+	labels.Add("label", clusterLabel+"="+clusterName)
+
+	containers, err := rt.ContainerList(ctx, types.ContainerListOptions{Filter: labels})
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+
+	for _, c := range containers {
+		if _, ok := helpTypeForAction(c.Labels[actionLabel]); !ok {
+			continue
+		}
+
+		info, err := rt.ContainerInspect(ctx, c.ID)
+		if err != nil || info.State == nil || !info.State.Running {
+			continue
+		}
+
+		return info, nil
+	}
+
+	return types.ContainerJSON{}, fmt.Errorf("no cluster action running for cluster '%s'", clusterName)
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestFindClusterContainer(t *testing.T) {
+	rt := newFakeRuntime()
+	ctx := getContext()
+
+	if _, err := findClusterContainer(rt, "test-cluster"); err == nil {
+		t.Error("Expected an error without any container for the cluster")
+	}
+
+	// tool containers share the name of the cluster action containers
+	tool, err := rt.ContainerCreate(ctx, &container.Config{Labels: map[string]string{clusterLabel: "test-cluster", actionLabel: actionKubectl}}, nil, krakenlibContainerName("test-cluster"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.Containers[tool.ID].Running = true
+
+	if _, err := findClusterContainer(rt, "test-cluster"); err == nil {
+		t.Error("Expected a kubectl container not to be attached to")
+	}
+	rt.ContainerRemove(ctx, tool.ID, types.ContainerRemoveOptions{Force: true})
+
+	labels := map[string]string{clusterLabel: "test-cluster", actionLabel: actionUp}
+	resp, err := rt.ContainerCreate(ctx, &container.Config{Labels: labels}, nil, krakenlibContainerName("test-cluster"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := findClusterContainer(rt, "test-cluster"); err == nil {
+		t.Error("Expected a container that is not running not to be attached to")
+	}
+
+	rt.Containers[resp.ID].Running = true
+	info, err := findClusterContainer(rt, "test-cluster")
+	if err != nil || info.ID != resp.ID {
+		t.Error("Expected container", resp.ID, "to be found, got", info.ID, err)
+	}
+
+	// a renamed container is found through its labels while it runs
+	rt.ContainerRename(ctx, resp.ID, "k2-renamed")
+
+	info, err = findClusterContainer(rt, "test-cluster")
+	if err != nil || info.Config.Labels[actionLabel] != actionUp {
+		t.Error("Expected container", resp.ID, "to be found by label, got", info.ID, err)
+	}
+
+	if _, err := findClusterContainer(rt, "other-cluster"); err == nil {
+		t.Error("Expected no container to be found for another cluster")
+	}
+}
+
+func TestFollowClusterAction(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.Run = func(config *container.Config) (string, int) {
+		return "PLAY RECAP\n", 0
+	}
+	ctx := getContext()
+
+	// ssh-refresh takes no lock, its owner is only known from the labels of its container
+	start := func(labels map[string]string) string {
+		resp, err := rt.ContainerCreate(ctx, &container.Config{Labels: labels}, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rt.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{})
+		rt.Containers[resp.ID].Running = true
+		return resp.ID
+	}
+
+	owned := start(containerLabels("test-cluster", actionSSHRefresh))
+	action, statusCode, err := followClusterAction(rt, "test-cluster")
+	if err != nil || action != actionSSHRefresh || statusCode != 0 {
+		t.Fatal("Expected to follow the ssh-refresh, got", action, statusCode, err)
+	}
+	if rt.Containers[owned].Removed {
+		t.Error("Expected the container of a running kraken command to be left to it")
+	}
+	rt.Containers[owned].Running = false
+
+	orphanLabels := containerLabels("test-cluster", actionSSHRefresh)
+	orphanLabels[ownerPIDLabel] = strconv.Itoa(1 << 30)
+	orphan := start(orphanLabels)
+	if _, _, err := followClusterAction(rt, "test-cluster"); err != nil {
+		t.Fatal(err)
+	}
+	if !rt.Containers[orphan].Removed {
+		t.Error("Expected the container of a kraken command that is gone to be removed")
+	}
+}
@@ -64,7 +64,7 @@ var downCmd = &cobra.Command{
 
 		onFailure := func(out []byte) {
 			fmt.Printf("ERROR bringing down %s \n", clusterName)
-			fmt.Printf("%s", out)
+			printFailureSummary(actionDown, out)
 			clusterHelpError(HelpTypeDestroyed, ClusterConfigPath)
 		}
 
@@ -76,13 +76,30 @@ var downCmd = &cobra.Command{
 			clusterHelp(HelpTypeDestroyed, ClusterConfigPath)
 		}
 
-		ExitCode, err = runKrakenLibCommand(spinnerPrefix, command, ClusterConfigPath, onFailure, onSuccess)
+		// errors past this point are not caused by the command line, skip the usage text
+		cmd.SilenceUsage = true
+
+		if resumeAction {
+			if command, err = resumeCommand(actionDown, command, ClusterConfigPath); err != nil {
+				return err
+			}
+		}
+
+		unlock, err := lockCluster(actionDown, lockWait)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		ExitCode, err = runKrakenLibCommand(actionDown, spinnerPrefix, command, ClusterConfigPath, onFailure, onSuccess)
 		return err
 	},
 }
 
 func init() {
 	clusterCmd.AddCommand(downCmd)
+	addRetryFlags(downCmd)
+	addResumeFlag(downCmd)
 
 	downCmd.PersistentFlags().StringVar(
 		&downtagsList,
@@ -1,12 +1,12 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path"
-	"strings"
+	"time"
 
-	"github.com/docker/docker/client"
 	"github.com/spf13/cobra"
 	"golang.org/x/net/context"
 )
@@ -23,6 +23,32 @@ const (
 	HelpTypeUpdated
 )
 
+// kraken-lib actions, recorded on the containers that run them
+const (
+	actionUp         string = "up"
+	actionDown       string = "down"
+	actionUpdate     string = "update"
+	actionSSHRefresh string = "ssh-refresh"
+	actionGenerate   string = "generate"
+	actionKubectl    string = "kubectl"
+	actionHelm       string = "helm"
+	actionExec       string = "exec"
+)
+
+// helpTypeForAction gives the post processing message handling of a cluster action.
+func helpTypeForAction(action string) (HelpType, bool) {
+	switch action {
+	case actionUp, actionSSHRefresh:
+		return HelpTypeCreated, true
+	case actionDown:
+		return HelpTypeDestroyed, true
+	case actionUpdate:
+		return HelpTypeUpdated, true
+	}
+
+	return HelpTypeCreated, false
+}
+
 func preRunGetClusterConfig(cmd *cobra.Command, args []string) error {
 	if ClusterConfigPath == "" {
 		return fmt.Errorf("please pass a valid kraken config file")
@@ -40,106 +66,168 @@ func preRunGetClusterConfig(cmd *cobra.Command, args []string) error {
 	return initClusterConfig(ClusterConfigPath)
 }
 
-func pullKrakenContainerImage(containerImage string) (*client.Client, context.Context, error) {
+func pullKrakenContainerImage(containerImage string) (ContainerRuntime, context.Context, error) {
 	terminalSpinner.Prefix = fmt.Sprintf("Pulling image '%s' ", containerImage)
 	terminalSpinner.Start()
 
-	cli, err := getClient()
+	rt, err := newContainerRuntime()
 	if err != nil {
 		return nil, nil, err
 	}
 
 	backgroundCtx := getContext()
-	authConfig64, err := getAuthConfig64(backgroundCtx, cli)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	if err = pullImage(backgroundCtx, cli, authConfig64); err != nil {
+	if err = ensureImage(backgroundCtx, rt); err != nil {
 		return nil, nil, err
 	}
 
 	terminalSpinner.Stop()
-	return cli, backgroundCtx, nil
+	return rt, backgroundCtx, nil
 }
 
-func runKrakenLibCommand(spinnerPrefix string, command []string, clusterConfigPath string, onError func([]byte), onSuccess func([]byte)) (int, error) {
-	cli, backgroundCtx, err := pullKrakenContainerImage(containerImage)
-	if err != nil {
-		return 1, err
-	}
+// runKrakenLibCommand runs a cluster action, rerunning it from the stage that failed up to
+// --retries times. Every attempt is recorded in the history of the cluster, and what they
+// wrote is given to the host user once they are done.
+func runKrakenLibCommand(action string, spinnerPrefix string, command []string, clusterConfigPath string, onError func([]byte), onSuccess func([]byte)) (int, error) {
+	defer giveActionOutputToHost(action)
 
-	// verbosity false here means show spinner but no container output
-	if !verbosity {
-		terminalSpinner.Prefix = spinnerPrefix
-		terminalSpinner.Start()
-	}
+	attempts := actionRetries + 1
+	backoff := retryBackoff
 
-	ctx, cancel := getTimedContext()
-	defer cancel()
+	for attempt := 1; ; attempt++ {
+		prefix := spinnerPrefix
+		if attempts > 1 {
+			prefix = fmt.Sprintf("%s(attempt %d/%d) ", spinnerPrefix, attempt, attempts)
+		}
 
-	resp, statusCode, timeout, err := containerAction(ctx, cli, command, clusterConfigPath)
-	if err != nil {
-		return 1, err
-	}
+		// the failure of an attempt that is retried is only kept to find its stage
+		var failedOutput []byte
+		var failure *ansibleFailure
+		onAttemptError := onError
+		if attempt < attempts {
+			onAttemptError = func(out []byte) {
+				failedOutput = out
+				if currentRun != nil {
+					failure = currentRun.failure
+				}
+			}
+		}
 
-	defer timeout()
+		statusCode, err := runKrakenLibCommandAttempt(action, attempt, prefix, command, clusterConfigPath, onAttemptError, onSuccess)
+		if attempt == attempts || !isRetryable(statusCode, err) {
+			switch {
+			case attempts == 1:
+			case statusCode == 0 && err == nil:
+				fmt.Printf("Succeeded on attempt %d of %d \n", attempt, attempts)
+			default:
+				fmt.Printf("Failed on attempt %d of %d \n", attempt, attempts)
+			}
+			return statusCode, err
+		}
 
-	// verbosity false here means show spinner but no container output
-	if !verbosity {
-		terminalSpinner.Stop()
+		stage := failedStage(failure, failedOutput, err)
+		command = retryCommandTags(command, stage)
+		if err != nil {
+			fmt.Printf("Attempt %d of %d failed: %s \n", attempt, attempts, err)
+		} else if stage != "" {
+			fmt.Printf("Attempt %d of %d failed in stage '%s' \n", attempt, attempts, stage)
+		} else {
+			fmt.Printf("Attempt %d of %d failed \n", attempt, attempts)
+		}
+		fmt.Printf("Retrying in %s \n", backoff)
+
+		time.Sleep(backoff)
+		backoff *= 2
 	}
+}
 
-	out, err := printContainerLogs(backgroundCtx, cli, resp)
-	if err != nil {
-		return 1, err
+// runKrakenLibCommandAttempt runs an action once. Cluster actions are recorded in the
+// history of the cluster, others, such as generate, have no cluster to record them for.
+func runKrakenLibCommandAttempt(action string, attempt int, spinnerPrefix string, command []string, clusterConfigPath string, onError func([]byte), onSuccess func([]byte)) (int, error) {
+	record := newHistoryRecord(action, attempt, command, clusterConfigPath)
+	if _, ok := helpTypeForAction(action); !ok {
+		return runRecordedKrakenLibCommand(record, spinnerPrefix, command, clusterConfigPath, onError, onSuccess)
 	}
 
-	if len(strings.TrimSpace(logPath)) > 0 {
-		if err := writeLog(logPath, out); err != nil {
-			return 1, err
-		}
+	currentRun = record
+	defer func() { currentRun = nil }()
+
+	statusCode, err := runRecordedKrakenLibCommand(record, spinnerPrefix, command, clusterConfigPath, onError, onSuccess)
+
+	record.finish(statusCode, err)
+	if err := appendHistory(getFirstClusterName(), record); err != nil {
+		fmt.Printf("Could not record the action in the cluster history: %s \n", err)
 	}
 
-	if statusCode != 0 {
-		onError(out)
-	} else {
-		onSuccess(out)
+	if err := pruneRunLogs(getFirstClusterName(), time.Now()); err != nil {
+		fmt.Printf("Could not remove old logs of the cluster: %s \n", err)
 	}
 
-	return statusCode, nil
+	return statusCode, err
 }
 
-func runKrakenLibCommandNoSpinner(command []string, clusterConfigPath string, onError func([]byte), onSuccess func([]byte)) (int, error) {
-	cli, backgroundCtx, err := pullKrakenContainerImage(containerImage)
-	if err != nil {
+func runRecordedKrakenLibCommand(record *historyRecord, spinnerPrefix string, command []string, clusterConfigPath string, onError func([]byte), onSuccess func([]byte)) (int, error) {
+	action := record.Action
+	if err := useClusterImage(action); err != nil {
 		return 1, err
 	}
 
-	ctx, cancel := getTimedContext()
-	defer cancel()
-
-	resp, statusCode, timeout, err := containerAction(ctx, cli, command, clusterConfigPath)
+	rt, backgroundCtx, err := pullKrakenContainerImage(containerImage)
 	if err != nil {
 		return 1, err
 	}
 
-	defer timeout()
-
-	out, err := printContainerLogs(backgroundCtx, cli, resp)
+	digest, err := verifyClusterImage(backgroundCtx, rt, action)
 	if err != nil {
 		return 1, err
 	}
 
-	if len(strings.TrimSpace(logPath)) > 0 {
-		if err := writeLog(logPath, out); err != nil {
-			return 1, err
+	record.ImageDigest = digest
+	if record.ImageDigest == "" {
+		record.ImageDigest, _ = imageDigest(backgroundCtx, rt, containerImage)
+	}
+
+	// verbosity false here means show the stage progress but no container output,
+	// verbose output only gets a line for every stage
+	progress := newStageProgress("", os.Stdout, false)
+	finalMsg := ""
+	if !verbosity {
+		progress = newStageProgress(spinnerPrefix, os.Stdout, isTerminal(os.Stdout))
+		finalMsg = terminalSpinner.FinalMSG
+	}
+	progress.Start()
+
+	ctx, cancel := getTimedContext(action)
+	defer cancel()
+
+	var output bytes.Buffer
+	_, statusCode, timeout, err := containerAction(ctx, rt, action, command, clusterConfigPath, &output, progress, nil)
+	if timeout != nil {
+		defer timeout()
+	}
+	record.failure = progress.Failure()
+
+	if err != nil {
+		progress.Stop("")
+		switch err.(type) {
+		case *interruptedError:
+			return statusCode, err
+		case *timeoutError:
+			onError(output.Bytes())
+			return statusCode, err
 		}
+		return 1, err
 	}
 
+	progress.Stop(finalMsg)
+
+	out := output.Bytes()
+
 	if statusCode != 0 {
 		onError(out)
 	} else {
+		if err := recordClusterImage(action, digest); err != nil {
+			fmt.Printf("Could not record the kraken-lib image of the cluster: %s \n", err)
+		}
 		onSuccess(out)
 	}
 
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestRunKrakenLibCommandSuccess(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "kraken-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outputDir)
+	defer useOutputLocation(outputDir)()
+
+	rt := newFakeRuntime()
+	rt.Run = func(config *container.Config) (string, int) {
+		return "PLAY RECAP\n" + strings.Join(config.Cmd, " "), 0
+	}
+	defer useFakeRuntime(rt)()
+
+	var succeeded, failed bool
+	var output string
+	onFailure := func(out []byte) { failed = true }
+	onSuccess := func(out []byte) {
+		succeeded = true
+		output = string(out)
+	}
+
+	statusCode, err := runKrakenLibCommand(actionUp, "testing ", []string{"ansible-playbook", "ansible/up.yaml"}, "", onFailure, onSuccess)
+	if err != nil {
+		t.Fatal("Expected no error running kraken-lib command, got", err)
+	}
+
+	if statusCode != 0 || !succeeded || failed {
+		t.Error("Expected status 0 and only onSuccess to be called, got status", statusCode, "success", succeeded, "failure", failed)
+	}
+
+	if !strings.Contains(output, "ansible-playbook ansible/up.yaml") {
+		t.Error("Expected container output to be passed to onSuccess, got", output)
+	}
+
+	if len(rt.Pulled) != 1 || rt.Pulled[0] != containerImage {
+		t.Error("Expected", containerImage, "to be pulled once, got", rt.Pulled)
+	}
+
+	for _, c := range rt.Containers {
+		if !c.Removed {
+			t.Error("Expected container", c.Name, "to be removed after the action")
+		}
+	}
+}
+
+func TestRunKrakenLibCommandFailure(t *testing.T) {
+	output, err := ioutil.TempDir("", "kraken-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+	defer useOutputLocation(output)()
+
+	rt := newFakeRuntime()
+	rt.Run = func(config *container.Config) (string, int) {
+		return "fatal: [localhost]: FAILED!", 2
+	}
+	defer useFakeRuntime(rt)()
+
+	var succeeded, failed bool
+	onFailure := func(out []byte) { failed = true }
+	onSuccess := func(out []byte) { succeeded = true }
+
+	statusCode, err := runKrakenLibCommand(actionUp, "testing ", []string{"false"}, "", onFailure, onSuccess)
+	if err != nil {
+		t.Fatal("Expected no error running kraken-lib command, got", err)
+	}
+
+	if statusCode != 2 || succeeded || !failed {
+		t.Error("Expected status 2 and only onFailure to be called, got status", statusCode, "success", succeeded, "failure", failed)
+	}
+}
+
+func TestPullKrakenContainerImageErrors(t *testing.T) {
+	output, err := ioutil.TempDir("", "kraken-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+	defer useOutputLocation(output)()
+
+	rt := newFakeRuntime()
+	rt.PullOutput = `{"status":"Pulling from samsung_cnct/kraken-lib"}` + "\n" + `{"error":"unauthorized: access denied"}`
+	defer useFakeRuntime(rt)()
+
+	if _, _, err := pullKrakenContainerImage(containerImage); err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Error("Expected the registry error from the pull stream, got", err)
+	}
+
+	rt.PullErr = fmt.Errorf("cannot connect to the Docker daemon")
+	statusCode, err := runKrakenLibCommand(actionUp, "testing ", []string{"true"}, "", func([]byte) {}, func([]byte) {})
+	if err == nil || statusCode != 1 {
+		t.Error("Expected pull failure to fail the command with status 1, got", statusCode, err)
+	}
+	terminalSpinner.Stop()
+}
+
+func TestPullPolicy(t *testing.T) {
+	output, err := ioutil.TempDir("", "kraken-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+	defer useOutputLocation(output)()
+
+	rt := newFakeRuntime()
+	defer useFakeRuntime(rt)()
+	defer krakenConfig.Set("container.pull", pullAlways)
+	defer terminalSpinner.Stop()
+
+	krakenConfig.Set("container.pull", pullNever)
+	if _, _, err := pullKrakenContainerImage(containerImage); err == nil || !strings.Contains(err.Error(), "not available locally") {
+		t.Error("Expected --pull=never to fail without a local image, got", err)
+	}
+
+	krakenConfig.Set("container.pull", pullMissing)
+	for i := 0; i < 2; i++ {
+		if _, _, err := pullKrakenContainerImage(containerImage); err != nil {
+			t.Fatal("Expected --pull=missing to succeed, got", err)
+		}
+	}
+	if len(rt.Pulled) != 1 {
+		t.Error("Expected --pull=missing to pull the image only once, got", rt.Pulled)
+	}
+
+	krakenConfig.Set("container.pull", pullNever)
+	rt.PullErr = fmt.Errorf("no route to host")
+	if _, _, err := pullKrakenContainerImage(containerImage); err != nil {
+		t.Error("Expected --pull=never to use the local image without pulling, got", err)
+	}
+
+	krakenConfig.Set("container.pull", pullAlways)
+	if _, _, err := pullKrakenContainerImage(containerImage); err == nil {
+		t.Error("Expected --pull=always to pull even with a local image")
+	}
+
+	krakenConfig.Set("container.pull", "sometimes")
+	if _, _, err := pullKrakenContainerImage(containerImage); err == nil || !strings.Contains(err.Error(), "unsupported pull policy") {
+		t.Error("Expected an unsupported pull policy to be refused, got", err)
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// historyFile is the ledger of the actions run against a cluster, one JSON record per line.
+const historyFile string = "history.jsonl"
+
+var historyJSON bool
+
+// historyRecord is the ledger entry of one kraken-lib action against a cluster.
+type historyRecord struct {
+	ID              string    `json:"id"`
+	Action          string    `json:"action"`
+	Attempt         int       `json:"attempt,omitempty"`
+	Tags            string    `json:"tags,omitempty"`
+	UpdateNodepools string    `json:"updateNodepools,omitempty"`
+	AddNodepools    string    `json:"addNodepools,omitempty"`
+	RemoveNodepools string    `json:"removeNodepools,omitempty"`
+	ConfigHash      string    `json:"configHash,omitempty"`
+	ImageDigest     string    `json:"imageDigest,omitempty"`
+	CLIVersion      string    `json:"cliVersion"`
+	User            string    `json:"user"`
+	Started         time.Time `json:"started"`
+	Ended           time.Time `json:"ended"`
+	ExitCode        int       `json:"exitCode"`
+	TimedOut        bool      `json:"timedOut,omitempty"`
+	TimedOutStage   string    `json:"timedOutStage,omitempty"`
+	StartAtTask     string    `json:"startAtTask,omitempty"`
+	FailedTask      string    `json:"failedTask,omitempty"`
+	LogFile         string    `json:"logFile,omitempty"`
+
+	// failure is the last task failure of the action, from its ansible events
+	failure *ansibleFailure
+}
+
+// currentRun is the record of the action being run, if any.
+var currentRun *historyRecord
+
+// newHistoryRecord starts the record of an attempt at action, taking its tags and nodepool
+// lists from the ansible-playbook command line that runs it.
+func newHistoryRecord(action string, attempt int, command []string, clusterConfigPath string) *historyRecord {
+	started := time.Now()
+	id := fmt.Sprintf("%s-%s", started.Format("20060102-150405"), action)
+	if attempt > 1 {
+		id = fmt.Sprintf("%s-%d", id, attempt)
+	}
+
+	record := &historyRecord{
+		ID:         id,
+		Action:     action,
+		Attempt:    attempt,
+		CLIVersion: cliVersion(),
+		User:       currentUserName(),
+		Started:    started,
+	}
+	record.LogFile = runLogPath(getFirstClusterName(), record.ID)
+
+	for i := 0; i+1 < len(command); i++ {
+		switch command[i] {
+		case "--tags":
+			record.Tags = command[i+1]
+		case "--start-at-task":
+			record.StartAtTask = command[i+1]
+		case "--extra-vars":
+			for _, extraVar := range strings.Fields(command[i+1]) {
+				parts := strings.SplitN(extraVar, "=", 2)
+				if len(parts) != 2 {
+					continue
+				}
+
+				switch parts[0] {
+				case "update_nodepools":
+					record.UpdateNodepools = parts[1]
+				case "add_nodepools":
+					record.AddNodepools = parts[1]
+				case "remove_nodepools":
+					record.RemoveNodepools = parts[1]
+				}
+			}
+		}
+	}
+
+	if hash, err := fileHash(clusterConfigPath); err == nil {
+		record.ConfigHash = hash
+	}
+
+	return record
+}
+
+// finish completes the record with the outcome of the action, the stage that was running
+// should it have timed out, and the task it failed in.
+func (r *historyRecord) finish(exitCode int, err error) {
+	r.Ended = time.Now()
+	r.ExitCode = exitCode
+
+	if timeout, ok := err.(*timeoutError); ok {
+		r.TimedOut = true
+		r.TimedOutStage = timeout.Stage
+	}
+
+	if exitCode == 0 {
+		return
+	}
+
+	if r.failure != nil {
+		r.FailedTask = fullTaskName(r.failure.Role, r.failure.Task)
+		return
+	}
+
+	// without a failed task, the action was stopped in the last task that started
+	if out, err := ioutil.ReadFile(r.LogFile); err == nil {
+		r.FailedTask = lastTask(out)
+	}
+}
+
+func (r *historyRecord) details() string {
+	var details []string
+	if r.Tags != "" {
+		details = append(details, "tags="+r.Tags)
+	}
+	if r.UpdateNodepools != "" {
+		details = append(details, "update="+r.UpdateNodepools)
+	}
+	if r.AddNodepools != "" {
+		details = append(details, "add="+r.AddNodepools)
+	}
+	if r.RemoveNodepools != "" {
+		details = append(details, "remove="+r.RemoveNodepools)
+	}
+	if r.StartAtTask != "" {
+		details = append(details, fmt.Sprintf("resumed at '%s'", r.StartAtTask))
+	}
+	if r.Attempt > 1 {
+		details = append(details, fmt.Sprintf("attempt=%d", r.Attempt))
+	}
+	if r.TimedOut {
+		details = append(details, "timed out")
+		if r.TimedOutStage != "" {
+			details[len(details)-1] += " in " + r.TimedOutStage
+		}
+	}
+
+	return strings.Join(details, " ")
+}
+
+// fileHash is the sha256 digest of the contents of a file.
+func fileHash(filePath string) (string, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func historyPath(clusterName string) string {
+	return filepath.Join(outputLocation, clusterName, historyFile)
+}
+
+// appendHistory adds record to the ledger of the cluster.
+func appendHistory(clusterName string, record *historyRecord) error {
+	historyFilePath := historyPath(clusterName)
+	if err := os.MkdirAll(filepath.Dir(historyFilePath), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(historyFilePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer Close(file)
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// readHistory returns the ledger of the cluster, oldest record first.
+func readHistory(clusterName string) ([]historyRecord, error) {
+	file, err := os.Open(historyPath(clusterName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	defer Close(file)
+
+	var records []historyRecord
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var record historyRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("unreadable record on line %d of %s: %v", line, historyPath(clusterName), err)
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+func printHistory(out io.Writer, records []historyRecord) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tACTION\tSTARTED\tDURATION\tEXIT CODE\tUSER\tDETAILS")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", r.ID, r.Action, r.Started.Format("2006-01-02 15:04:05"),
+			r.Ended.Sub(r.Started).Round(time.Second), r.ExitCode, r.User, r.details())
+	}
+	w.Flush()
+}
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the actions run against a Kraken cluster",
+	Long: `Lists the up, update, down and ssh refresh actions run against the Kraken cluster
+	described in the specified configuration yaml, oldest first`,
+	SilenceErrors: true,
+	SilenceUsage:  false,
+	PreRunE:       preRunGetClusterConfig,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// we do not support any additional arguments, we error out then if there are.
+		if len(args) > 0 {
+			return fmt.Errorf("Unexpected argument(s) passed %v", args)
+		}
+
+		cmd.SilenceUsage = true
+
+		records, err := readHistory(getFirstClusterName())
+		if err != nil {
+			return err
+		}
+
+		if historyJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			for i := range records {
+				if err := encoder.Encode(&records[i]); err != nil {
+					return err
+				}
+			}
+		} else if len(records) == 0 {
+			fmt.Printf("No history for cluster '%s' \n", getFirstClusterName())
+		} else {
+			printHistory(os.Stdout, records)
+		}
+
+		ExitCode = 0
+		return nil
+	},
+}
+
+// historyShowCmd represents the history show command
+var historyShowCmd = &cobra.Command{
+	Use:           "show <id>",
+	Short:         "Print the log of an action run against a Kraken cluster",
+	Long:          `Prints the log saved by the action with the given id, as listed by 'kraken cluster history'`,
+	SilenceErrors: true,
+	SilenceUsage:  false,
+	PreRunE:       preRunGetClusterConfig,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("Please pass the id of one action, run 'kraken cluster history' to list them")
+		}
+
+		cmd.SilenceUsage = true
+
+		clusterName := getFirstClusterName()
+		records, err := readHistory(clusterName)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			if record.ID != args[0] {
+				continue
+			}
+
+			if record.LogFile == "" {
+				return fmt.Errorf("action %s saved no log", record.ID)
+			}
+
+			if err := printLogFile(record.LogFile); err != nil {
+				return err
+			}
+
+			ExitCode = 0
+			return nil
+		}
+
+		return fmt.Errorf("no action %s in the history of cluster '%s'", args[0], clusterName)
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyShowCmd)
+
+	historyCmd.Flags().BoolVar(
+		&historyJSON,
+		"json",
+		false,
+		"print the records as JSON lines")
+}
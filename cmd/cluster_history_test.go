@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestNewHistoryRecord(t *testing.T) {
+	command := []string{
+		"ansible-playbook",
+		"ansible/update.yaml",
+		"--extra-vars",
+		"config_path=/tmp/config.yaml kraken_action=update update_nodepools=clusterNodes add_nodepools= remove_nodepools=oldNodes",
+		"--tags",
+		"all",
+	}
+
+	record := newHistoryRecord(actionUpdate, 1, command, "/does/not/exist")
+	if record.Action != actionUpdate || record.Tags != "all" || record.UpdateNodepools != "clusterNodes" ||
+		record.AddNodepools != "" || record.RemoveNodepools != "oldNodes" {
+		t.Errorf("Unexpected record %+v", record)
+	}
+
+	if record.ConfigHash != "" {
+		t.Error("Expected no config hash for a missing config file, got", record.ConfigHash)
+	}
+}
+
+func TestRunKrakenLibCommandRecordsHistory(t *testing.T) {
+	output, err := ioutil.TempDir("", "kraken-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+	defer useOutputLocation(output)()
+
+	configPath := filepath.Join(output, "config.yaml")
+	if err := ioutil.WriteFile(configPath, []byte("deployment: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := newFakeRuntime()
+	rt.Run = func(config *container.Config) (string, int) {
+		return "fatal: [localhost]: FAILED!", 2
+	}
+	defer useFakeRuntime(rt)()
+
+	onFailure := func(out []byte) { printFailureSummary(actionUp, out) }
+	if _, err := runKrakenLibCommand(actionUp, "testing ", []string{"ansible-playbook", "--tags", "provider"}, configPath, onFailure, func([]byte) {}); err != nil {
+		t.Fatal("Expected no error running kraken-lib command, got", err)
+	}
+
+	records, err := readHistory(getFirstClusterName())
+	if err != nil {
+		t.Fatal("Expected a readable history, got", err)
+	}
+
+	if len(records) != 1 {
+		t.Fatal("Expected one record, got", records)
+	}
+
+	record := records[0]
+	if record.Action != actionUp || record.Tags != "provider" || record.ExitCode != 2 || record.ImageDigest == "" {
+		t.Errorf("Unexpected record %+v", record)
+	}
+
+	if hash, _ := fileHash(configPath); record.ConfigHash != hash {
+		t.Error("Expected config hash", hash, "got", record.ConfigHash)
+	}
+
+	if data, err := ioutil.ReadFile(record.LogFile); err != nil || string(data) != "fatal: [localhost]: FAILED!" {
+		t.Error("Expected the record to point at the saved log, got", record.LogFile, err)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"time"
+)
+
+// how often a held lock is checked again while waiting for it
+var lockPollInterval = 2 * time.Second
+
+// clusterLock records who is running an action against a cluster. It is an advisory
+// lock: it only keeps kraken commands that check it from running concurrently.
+type clusterLock struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	User    string    `json:"user"`
+	Action  string    `json:"action"`
+	Started time.Time `json:"started"`
+}
+
+func (l *clusterLock) String() string {
+	return fmt.Sprintf("%s@%s (pid %d) running '%s' since %s", l.User, l.Host, l.PID, l.Action, l.Started.Format(time.RFC1123))
+}
+
+// isStale reports whether the lock holder is known to be gone. Only locks taken on
+// this host can be checked, a lock from another host is never considered stale.
+func (l *clusterLock) isStale() bool {
+	hostname, _ := os.Hostname()
+	return l.Host == hostname && !processExists(l.PID)
+}
+
+func clusterLockPath(clusterName string) string {
+	return path.Join(outputLocation, clusterName, ".lock")
+}
+
+func currentUserName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return os.Getenv("USER")
+}
+
+func readClusterLock(lockPath string) (*clusterLock, error) {
+	data, err := ioutil.ReadFile(lockPath)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &clusterLock{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("unreadable lock file %s: %v", lockPath, err)
+	}
+
+	return lock, nil
+}
+
+// tryLockCluster creates the lock file, failing if it already exists.
+func tryLockCluster(lockPath string, lock *clusterLock) error {
+	if err := os.MkdirAll(path.Dir(lockPath), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer Close(file)
+
+	// a lock that could not be written would hold the cluster for no one
+	if err := json.NewEncoder(file).Encode(lock); err != nil {
+		os.Remove(lockPath)
+		return err
+	}
+
+	return nil
+}
+
+// sameLock reports whether a and b are the same lock, read at different times.
+func sameLock(a *clusterLock, b *clusterLock) bool {
+	return a.PID == b.PID && a.Host == b.Host && a.Started.Equal(b.Started)
+}
+
+// removeStaleLock removes the lock file of holder, a stale lock. Other waiters may have
+// removed it already and taken the lock since, so it is first moved aside, which only one
+// of them can do, and put back if it turns out to be a new lock.
+func removeStaleLock(lockPath string, holder *clusterLock) error {
+	stalePath := fmt.Sprintf("%s.stale.%d", lockPath, os.Getpid())
+	if err := os.Rename(lockPath, stalePath); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer os.Remove(stalePath)
+
+	// a lock that was just taken may not be written yet
+	moved, err := readClusterLock(stalePath)
+	if err == nil && sameLock(moved, holder) {
+		return nil
+	}
+
+	// a lock taken since then by yet another waiter wins
+	if err := os.Link(stalePath, lockPath); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// lockCluster takes the lock of the first cluster in the config for action, waiting up to
+// wait for a live holder to let go. The returned func releases the lock.
+func lockCluster(action string, wait time.Duration) (func(), error) {
+	clusterName := getFirstClusterName()
+	lockPath := clusterLockPath(clusterName)
+	hostname, _ := os.Hostname()
+
+	lock := &clusterLock{
+		PID:     os.Getpid(),
+		Host:    hostname,
+		User:    currentUserName(),
+		Action:  action,
+		Started: time.Now(),
+	}
+
+	deadline := time.Now().Add(wait)
+	waiting := false
+
+	for {
+		err := tryLockCluster(lockPath, lock)
+		if err == nil {
+			break
+		}
+
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		holder, err := readClusterLock(lockPath)
+		switch {
+		case os.IsNotExist(err):
+			// the holder let go in the meantime
+			continue
+		case err != nil:
+			// a lock that was just taken may not be written yet, it is held until the deadline
+			if time.Now().After(deadline) {
+				return nil, fmt.Errorf("cluster '%s' is locked: %v, remove it with 'kraken cluster unlock --force' if no operation is running", clusterName, err)
+			}
+		case holder.isStale():
+			fmt.Printf("Removing stale lock on cluster '%s' held by %s \n", clusterName, holder)
+			if err := removeStaleLock(lockPath, holder); err != nil {
+				return nil, err
+			}
+			continue
+		case time.Now().After(deadline):
+			return nil, fmt.Errorf("cluster '%s' is locked by %s\nuse --wait-for-lock to wait for it, or 'kraken cluster unlock --force' if that operation is gone", clusterName, holder)
+		case !waiting:
+			fmt.Printf("Waiting for lock on cluster '%s' held by %s \n", clusterName, holder)
+			waiting = true
+		}
+
+		time.Sleep(lockPollInterval)
+	}
+
+	return func() {
+		// only remove the lock if it is still ours, it may have been forcibly taken over
+		if holder, err := readClusterLock(lockPath); err == nil && holder.PID == lock.PID && holder.Host == lock.Host {
+			os.Remove(lockPath)
+		}
+	}, nil
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockCluster(t *testing.T) {
+	output, err := ioutil.TempDir("", "kraken-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+
+	originalOutput := outputLocation
+	outputLocation = output
+	defer func() { outputLocation = originalOutput }()
+
+	lockPath := clusterLockPath(getFirstClusterName())
+
+	unlock, err := lockCluster("up", 0)
+	if err != nil {
+		t.Fatal("Expected to take the lock, got", err)
+	}
+
+	holder, err := readClusterLock(lockPath)
+	if err != nil {
+		t.Fatal("Expected a readable lock file, got", err)
+	}
+
+	if holder.PID != os.Getpid() || holder.Action != "up" {
+		t.Error("Expected lock held by this process for 'up', got", holder)
+	}
+
+	// our own process is alive, so a second action has to fail
+	if _, err := lockCluster("down", 0); err == nil || !strings.Contains(err.Error(), "running 'up'") {
+		t.Error("Expected second lock to fail naming the holder, got", err)
+	}
+
+	unlock()
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Error("Expected lock file to be removed on release")
+	}
+
+	// a lock from a process that no longer exists on this host is stale
+	hostname, _ := os.Hostname()
+	stale, _ := json.Marshal(&clusterLock{PID: 1 << 30, Host: hostname, Action: "down", Started: time.Now()})
+	if err := ioutil.WriteFile(lockPath, stale, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err = lockCluster("update", 0)
+	if err != nil {
+		t.Fatal("Expected stale lock to be taken over, got", err)
+	}
+	unlock()
+
+	// a waiter that saw the stale lock too leaves the new lock alone
+	unlock, err = lockCluster("update", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staleHolder := &clusterLock{}
+	json.Unmarshal(stale, staleHolder)
+	if err := removeStaleLock(lockPath, staleHolder); err != nil {
+		t.Fatal("Expected no error removing a lock that was already removed, got", err)
+	}
+	if holder, err := readClusterLock(lockPath); err != nil || holder.PID != os.Getpid() {
+		t.Error("Expected the new lock to be kept, got", holder, err)
+	}
+	if files, _ := ioutil.ReadDir(path.Dir(lockPath)); len(files) != 1 {
+		t.Error("Expected only the lock file to be left, got", len(files), "files")
+	}
+	unlock()
+
+	// a lock from another host can't be verified and is never stale
+	remote := &clusterLock{PID: 1 << 30, Host: hostname + ".elsewhere", Action: "down"}
+	if remote.isStale() {
+		t.Error("Expected lock from another host not to be stale")
+	}
+}
+
+func TestLockClusterWaitsForUnwrittenLock(t *testing.T) {
+	output, err := ioutil.TempDir("", "kraken-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+	defer useOutputLocation(output)()
+
+	originalInterval := lockPollInterval
+	lockPollInterval = 10 * time.Millisecond
+	defer func() { lockPollInterval = originalInterval }()
+
+	lockPath := clusterLockPath(getFirstClusterName())
+	if err := os.MkdirAll(path.Dir(lockPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// a lock file that was created but not written yet is held
+	if err := ioutil.WriteFile(lockPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lockCluster("up", 0); err == nil || !strings.Contains(err.Error(), "unlock --force") {
+		t.Error("Expected an unwritten lock to be held past the deadline, got", err)
+	}
+
+	// and taken once its holder lets go
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.Remove(lockPath)
+	}()
+
+	unlock, err := lockCluster("up", time.Second)
+	if err != nil {
+		t.Fatal("Expected to take the lock once it is released, got", err)
+	}
+	unlock()
+
+	// a lock that can't be written is not left behind, years past 9999 can't be encoded
+	lock := &clusterLock{Started: time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := tryLockCluster(lockPath, lock); err == nil {
+		t.Error("Expected a lock that can't be encoded to fail")
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Error("Expected the unwritten lock file to be removed, got", err)
+	}
+}
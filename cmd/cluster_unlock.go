@@ -0,0 +1,80 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var unlockForce bool
+
+// unlockCmd represents the unlock command
+var unlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Remove the operation lock of a Kraken cluster",
+	Long: `Removes the lock taken by 'up', 'down' and 'update' on the Kraken cluster described
+	in the specified configuration yaml. Stale locks, whose process is gone, are always removed.
+	A lock held by a running or unverifiable process is only removed with --force.`,
+	SilenceErrors: true,
+	SilenceUsage:  false,
+	PreRunE:       preRunGetClusterConfig,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clusterName := getFirstClusterName()
+
+		// we do not support any additional arguments, we error out then if there are.
+		if len(args) > 0 {
+			return fmt.Errorf("Unexpected argument(s) passed %v", args)
+		}
+
+		lockPath := clusterLockPath(clusterName)
+		holder, err := readClusterLock(lockPath)
+		if os.IsNotExist(err) {
+			fmt.Printf("Cluster '%s' is not locked \n", clusterName)
+			ExitCode = 0
+			return nil
+		}
+
+		if err != nil && !unlockForce {
+			return fmt.Errorf("%v, pass --force to remove it", err)
+		}
+
+		if err == nil && !holder.isStale() && !unlockForce {
+			return fmt.Errorf("cluster '%s' is locked by %s, pass --force to remove the lock anyway", clusterName, holder)
+		}
+
+		if err := os.Remove(lockPath); err != nil {
+			return err
+		}
+
+		fmt.Printf("Removed lock on cluster '%s' \n", clusterName)
+		ExitCode = 0
+		return nil
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(unlockCmd)
+
+	// takes the place of the --force of the cluster commands, which is about deprecated configs
+	unlockCmd.Flags().BoolVarP(
+		&unlockForce,
+		"force",
+		"f",
+		false,
+		"remove the lock even if its process is running or cannot be verified")
+}
@@ -64,7 +64,7 @@ var upCmd = &cobra.Command{
 
 		onFailure := func(out []byte) {
 			fmt.Printf("ERROR bringing up %s \n", clusterName)
-			fmt.Printf("%s", out)
+			printFailureSummary(actionUp, out)
 			clusterHelpError(HelpTypeCreated, ClusterConfigPath)
 		}
 
@@ -76,13 +76,30 @@ var upCmd = &cobra.Command{
 			clusterHelp(HelpTypeCreated, ClusterConfigPath)
 		}
 
-		ExitCode, err = runKrakenLibCommand(spinnerPrefix, command, ClusterConfigPath, onFailure, onSuccess)
+		// errors past this point are not caused by the command line, skip the usage text
+		cmd.SilenceUsage = true
+
+		if resumeAction {
+			if command, err = resumeCommand(actionUp, command, ClusterConfigPath); err != nil {
+				return err
+			}
+		}
+
+		unlock, err := lockCluster(actionUp, lockWait)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		ExitCode, err = runKrakenLibCommand(actionUp, spinnerPrefix, command, ClusterConfigPath, onFailure, onSuccess)
 		return err
 	},
 }
 
 func init() {
 	clusterCmd.AddCommand(upCmd)
+	addRetryFlags(upCmd)
+	addResumeFlag(upCmd)
 
 	upCmd.PersistentFlags().StringVar(
 		&upTagsList,
@@ -58,7 +58,7 @@ var updateCmd = &cobra.Command{
 
 		onFailure := func(out []byte) {
 			fmt.Printf("ERROR updating cluster %s \n", clusterName)
-			fmt.Printf("%s", out)
+			printFailureSummary(actionUpdate, out)
 			clusterHelpError(HelpTypeUpdated, ClusterConfigPath)
 		}
 
@@ -70,13 +70,30 @@ var updateCmd = &cobra.Command{
 			clusterHelp(HelpTypeUpdated, ClusterConfigPath)
 		}
 
-		ExitCode, err = runKrakenLibCommand(spinnerPrefix, command, ClusterConfigPath, onFailure, onSuccess)
+		// errors past this point are not caused by the command line, skip the usage text
+		cmd.SilenceUsage = true
+
+		if resumeAction {
+			if command, err = resumeCommand(actionUpdate, command, ClusterConfigPath); err != nil {
+				return err
+			}
+		}
+
+		unlock, err := lockCluster(actionUpdate, lockWait)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		ExitCode, err = runKrakenLibCommand(actionUpdate, spinnerPrefix, command, ClusterConfigPath, onFailure, onSuccess)
 		return err
 	},
 }
 
 func init() {
 	clusterCmd.AddCommand(updateCmd)
+	addRetryFlags(updateCmd)
+	addResumeFlag(updateCmd)
 	updateCmd.PersistentFlags().StringVarP(
 		&updateNodepools,
 		"update-nodepools",
@@ -0,0 +1,203 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var containerEnv []string
+var containerEnvFiles []string
+var containerMounts []string
+
+var envKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// extraEnvironment is the environment kraken.config and the command line add to the
+// kraken-lib container: the dotenv files of 'container.envFrom' and --env-file, then the
+// variables of 'container.env' and --env. Later settings win over earlier ones.
+func extraEnvironment() ([]string, error) {
+	var envs []string
+
+	files := append(krakenConfig.GetStringSlice("container.envFrom"), containerEnvFiles...)
+	for _, file := range files {
+		fileEnvs, err := readEnvFile(file)
+		if err != nil {
+			return nil, err
+		}
+		envs = append(envs, fileEnvs...)
+	}
+
+	variables := append(krakenConfig.GetStringSlice("container.env"), containerEnv...)
+	for _, variable := range variables {
+		env, err := parseEnv(variable)
+		if err != nil {
+			return nil, err
+		}
+		if env != "" {
+			envs = append(envs, env)
+		}
+	}
+
+	return envs, nil
+}
+
+// parseEnv turns KEY=VALUE into an environment variable, and KEY alone into the host
+// value of KEY, if it has one.
+func parseEnv(variable string) (string, error) {
+	key := strings.SplitN(variable, "=", 2)[0]
+	if !envKeyRegex.MatchString(key) {
+		return "", fmt.Errorf("invalid environment variable '%s', use KEY=VALUE or KEY", variable)
+	}
+
+	if strings.Contains(variable, "=") {
+		return variable, nil
+	}
+
+	if value, ok := os.LookupEnv(key); ok {
+		return key + "=" + value, nil
+	}
+
+	return "", nil
+}
+
+// readEnvFile reads the KEY=VALUE lines of a dotenv file. Blank lines, comments, 'export'
+// prefixes and quotes around values are skipped.
+func readEnvFile(path string) ([]string, error) {
+	file, err := os.Open(os.ExpandEnv(path))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read environment file: %v", err)
+	}
+	defer file.Close()
+
+	var envs []string
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || !envKeyRegex.MatchString(parts[0]) {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE, got '%s'", path, lineNumber, line)
+		}
+
+		value := parts[1]
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		envs = append(envs, parts[0]+"="+value)
+	}
+
+	return envs, scanner.Err()
+}
+
+// mergeEnvironment joins lists of environment variables. A variable set more than once keeps
+// its first position and its last value.
+func mergeEnvironment(lists ...[]string) []string {
+	var merged []string
+	index := map[string]int{}
+	for _, list := range lists {
+		for _, env := range list {
+			key := strings.SplitN(env, "=", 2)[0]
+			if i, ok := index[key]; ok {
+				merged[i] = env
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, env)
+		}
+	}
+
+	return merged
+}
+
+// environmentKeys are the names of envs, to show them without their secrets.
+func environmentKeys(envs []string) []string {
+	keys := make([]string, 0, len(envs))
+	for _, env := range envs {
+		keys = append(keys, strings.SplitN(env, "=", 2)[0])
+	}
+
+	return keys
+}
+
+// extraMounts are the mounts of 'container.mounts' in kraken.config and --mount, each
+// host:container[:ro|rw]. Host paths must exist.
+func extraMounts() ([]plannedMount, error) {
+	var planned []plannedMount
+
+	mounts := append(krakenConfig.GetStringSlice("container.mounts"), containerMounts...)
+	for _, mount := range mounts {
+		m, err := parseMount(mount)
+		if err != nil {
+			return nil, err
+		}
+		planned = append(planned, m)
+	}
+
+	return planned, nil
+}
+
+func parseMount(mount string) (plannedMount, error) {
+	hostPart, containerPath, mode, err := splitMount(mount)
+	if err != nil {
+		return plannedMount{}, err
+	}
+
+	hostPath, err := filepath.Abs(os.ExpandEnv(hostPart))
+	if err != nil {
+		return plannedMount{}, err
+	}
+
+	if _, err := os.Stat(hostPath); err != nil {
+		return plannedMount{}, fmt.Errorf("cannot mount '%s': %v", mount, err)
+	}
+
+	if !path.IsAbs(containerPath) {
+		return plannedMount{}, fmt.Errorf("cannot mount '%s': the container path must be absolute", mount)
+	}
+
+	return plannedMount{hostPath, containerPath, mode, "--mount or container.mounts"}, nil
+}
+
+// splitMount splits host:container[:ro|rw] from the right, the host path may have a colon
+// of its own, as in C:\keys:/keys:ro.
+func splitMount(mount string) (string, string, string, error) {
+	i := strings.LastIndex(mount, ":")
+	if i <= 0 {
+		return "", "", "", fmt.Errorf("invalid mount '%s', use host:container[:ro|rw]", mount)
+	}
+
+	hostPart, containerPath, mode := mount[:i], mount[i+1:], mountReadWrite
+
+	// container paths are absolute, so what follows the last colon is a mode when the part
+	// before it is the container path
+	if j := strings.LastIndex(hostPart, ":"); j > 0 && !strings.HasPrefix(containerPath, "/") && strings.HasPrefix(hostPart[j+1:], "/") {
+		hostPart, containerPath, mode = hostPart[:j], hostPart[j+1:], containerPath
+		if mode != mountReadOnly && mode != mountReadWrite {
+			return "", "", "", fmt.Errorf("invalid mount mode '%s' in '%s', use ro or rw", mode, mount)
+		}
+	}
+
+	return hostPart, containerPath, mode, nil
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExtraEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kraken-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	envFile := filepath.Join(dir, "build.env")
+	content := "# build settings\n\nexport STAGE=ci\nOWNER=\"build team\"\nREGION=us-east-1\n"
+	if err := ioutil.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("KRAKEN_TEST_HOST_VALUE", "from-host")
+	defer os.Unsetenv("KRAKEN_TEST_HOST_VALUE")
+
+	krakenConfig.Set("container.envFrom", []string{envFile})
+	krakenConfig.Set("container.env", []string{"REGION=us-west-2", "KRAKEN_TEST_HOST_VALUE", "KRAKEN_TEST_UNSET"})
+	defer krakenConfig.Set("container.envFrom", []string{})
+	defer krakenConfig.Set("container.env", []string{})
+
+	originalEnv := containerEnv
+	defer func() { containerEnv = originalEnv }()
+	containerEnv = []string{"STAGE=manual"}
+
+	envs, err := extraEnvironment()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	expected := []string{"STAGE=manual", "OWNER=build team", "REGION=us-west-2", "KRAKEN_TEST_HOST_VALUE=from-host"}
+	if merged := mergeEnvironment(envs); !reflect.DeepEqual(merged, expected) {
+		t.Error("Expected", expected, "got", merged)
+	}
+
+	containerEnv = []string{"not a key=value"}
+	if _, err := extraEnvironment(); err == nil {
+		t.Error("Expected an error for an invalid variable")
+	}
+}
+
+func TestMergeEnvironment(t *testing.T) {
+	merged := mergeEnvironment([]string{"A=1", "B=2"}, []string{"C=3", "A=4"})
+	if expected := []string{"A=4", "B=2", "C=3"}; !reflect.DeepEqual(merged, expected) {
+		t.Error("Expected", expected, "got", merged)
+	}
+}
+
+func TestParseMount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kraken-mount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if mount, err := parseMount(dir + ":/data:ro"); err != nil || mount.bind() != dir+":/data:ro" {
+		t.Error("Expected a read-only bind of", dir, "got", mount, err)
+	}
+
+	if mount, err := parseMount(dir + ":/data"); err != nil || mount.Mode != mountReadWrite {
+		t.Error("Expected a read-write bind of", dir, "got", mount, err)
+	}
+
+	// the mode and the container path are taken from the right, windows drives keep their colon
+	windows := map[string][]string{
+		`C:\keys:/keys:ro`: {`C:\keys`, "/keys", mountReadOnly},
+		`C:\keys:/keys`:    {`C:\keys`, "/keys", mountReadWrite},
+		"/keys:/keys:rw":   {"/keys", "/keys", mountReadWrite},
+	}
+	for mount, expected := range windows {
+		hostPart, containerPath, mode, err := splitMount(mount)
+		if err != nil || hostPart != expected[0] || containerPath != expected[1] || mode != expected[2] {
+			t.Error("Expected", mount, "to split into", expected, "got", hostPart, containerPath, mode, err)
+		}
+	}
+
+	invalid := []string{
+		dir,
+		dir + ":data",
+		`C:\keys`,
+		dir + ":/data:rx",
+		filepath.Join(dir, "missing") + ":/data",
+	}
+	for _, mount := range invalid {
+		if _, err := parseMount(mount); err == nil {
+			t.Error("Expected an error for mount", mount)
+		}
+	}
+}
@@ -20,14 +20,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
-	"path/filepath"
-	"reflect"
-	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -35,6 +33,7 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/namesgenerator"
+	"github.com/mattn/go-isatty"
 	"golang.org/x/net/context"
 )
 
@@ -54,33 +53,18 @@ func base64EncodeAuth(auth types.AuthConfig) (string, error) {
 	return base64.URLEncoding.EncodeToString(buf.Bytes()), nil
 }
 
-func streamLogs(ctx context.Context, cli *client.Client, resp types.ContainerCreateResponse) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	containerLogOpts := types.ContainerLogsOptions{ShowStdout: true, Follow: true}
-	reader, err := cli.ContainerLogs(ctx, resp.ID, containerLogOpts)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	defer Close(reader)
-
-	if _, err = io.Copy(os.Stdout, reader); err != nil && err != io.EOF {
-		log.Fatal(err)
-	}
-}
-
-func printContainerLogs(ctx context.Context, cli *client.Client, resp types.ContainerCreateResponse) ([]byte, error) {
+func printContainerLogs(ctx context.Context, rt ContainerRuntime, resp types.ContainerCreateResponse) ([]byte, error) {
 	containerLogOpts := types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true}
-	out, err := cli.ContainerLogs(ctx, resp.ID, containerLogOpts)
+	reader, err := rt.ContainerLogs(ctx, resp.ID, containerLogOpts)
 	if err != nil {
 		return nil, err
 	}
 
-	defer Close(out)
+	defer Close(reader)
 
-	return ioutil.ReadAll(out)
+	var out bytes.Buffer
+	err = demuxLogs(reader, &out, &out)
+	return out.Bytes(), err
 }
 
 // Convert dashes to underscore (if any) in cluster name and append to helm_override_ to be able to pull correct env for helm override
@@ -102,6 +86,7 @@ func containerEnvironment() []string {
 	envs = appendIfValueNotEmpty(envs, "CLOUDSDK_COMPUTE_ZONE")
 	envs = appendIfValueNotEmpty(envs, "CLOUDSDK_COMPUTE_REGION")
 	envs = appendIfValueNotEmpty(envs, setHelmOverrideEnv(containerName))
+	envs = append(envs, proxyEnvironment()...)
 
 	return envs
 }
@@ -115,88 +100,77 @@ func appendIfValueNotEmpty(envs []string, envKey string) []string {
 	return envs
 }
 
-func makeMounts(clusterConfigPath string) (*container.HostConfig, []string) {
-	configEnvs := []string{}
+// makeMounts builds the host config of a kraken-lib container: the mounts of planMounts,
+// resource limits and network settings, and the environment variables the cluster config
+// refers to.
+func makeMounts(clusterConfigPath string) (*container.HostConfig, []string, error) {
+	plan, configEnvs, err := planMounts(clusterConfigPath)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// cluster configuration is always mounted
-	var hostConfig *container.HostConfig
-	if len(strings.TrimSpace(clusterConfigPath)) > 0 {
-		hostConfig = &container.HostConfig{
-			Binds: []string{
-				clusterConfigPath + ":" + clusterConfigPath,
-				outputLocation + ":" + outputLocation},
-		}
+	for _, skipped := range plan.Skipped {
+		// stdout may be the output of a tool, piped somewhere else
+		fmt.Fprintf(os.Stderr, "Not mounting %s: %s \n", skipped.Path, skipped.Reason)
+	}
 
-		deployment := reflect.ValueOf(clusterConfig.Sub("deployment"))
-		parseMounts(deployment, hostConfig, &configEnvs)
+	hostConfig := &container.HostConfig{Binds: plan.binds()}
 
-	} else {
-		hostConfig = &container.HostConfig{
-			Binds: []string{
-				outputLocation + ":" + outputLocation},
-		}
+	// podman relabels or denies bind mounts of arbitrary host paths under SELinux, so
+	// labeling is turned off for the container instead of relabeling user files. Who owns
+	// what kraken-lib writes to the bound paths is left to containerUser: only a rootless
+	// engine maps container root to the invoking user.
+	if dockerClient.Runtime == runtimePodman {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "label=disable")
+	}
+
+	if err := applyContainerSettings(hostConfig); err != nil {
+		return nil, nil, err
 	}
 
-	return hostConfig, configEnvs
+	return hostConfig, configEnvs, nil
 }
 
-func parseMounts(deployment reflect.Value, hostConfig *container.HostConfig, configEnvs *[]string) {
-	switch deployment.Kind() {
-	case reflect.Ptr:
-		deploymentValue := deployment.Elem()
+// tlsEnabled reads whether to use TLS with the remote API. It is 'tls.enabled' in the kraken
+// config file, next to 'tls.caBundle', or --tls. A plain 'tls: true' is still read, but
+// leaves no room for the other tls settings.
+func tlsEnabled() (bool, error) {
+	if flag := RootCmd.PersistentFlags().Lookup("tls"); flag != nil && flag.Changed {
+		return dockerClient.TLSEnabled, nil
+	}
 
-		// Check if the pointer is nil
-		if !deploymentValue.IsValid() {
-			return
+	switch value := krakenConfig.Get("tls").(type) {
+	case nil, map[string]interface{}:
+		return krakenConfig.GetBool("tls.enabled"), nil
+	case bool:
+		return value, nil
+	case string:
+		if enabled, err := strconv.ParseBool(value); err == nil {
+			return enabled, nil
 		}
+	}
 
-		parseMounts(deploymentValue, hostConfig, configEnvs)
-
-	case reflect.Interface:
-		deploymentValue := deployment.Elem()
-		parseMounts(deploymentValue, hostConfig, configEnvs)
-
-	case reflect.Struct:
-		for i := 0; i < deployment.NumField(); i++ {
-			parseMounts(deployment.Field(i), hostConfig, configEnvs)
-		}
+	return false, fmt.Errorf("invalid 'tls' setting in the kraken config: use 'tls.enabled: true' and 'tls.caBundle: <file>', or 'tls: true' without a CA bundle")
+}
 
-	case reflect.Slice:
-		for i := 0; i < deployment.Len(); i++ {
-			parseMounts(deployment.Index(i), hostConfig, configEnvs)
-		}
+func getClient() (*client.Client, error) {
+	var httpClient *http.Client
 
-	case reflect.Map:
-		for _, key := range deployment.MapKeys() {
-			originalValue := deployment.MapIndex(key)
-			parseMounts(originalValue, hostConfig, configEnvs)
-		}
-	case reflect.String:
-		reflectedString := deployment.String()
-
-		// if the string was an environment variable we need to add it to the configEnvs
-		regex := regexp.MustCompile(`\$[A-Za-z0-9_]+`)
-		matches := regex.FindAllString(reflectedString, -1)
-		for _, value := range matches {
-			*configEnvs = append(*configEnvs, strings.Replace(value, "$", "", -1)+"="+os.ExpandEnv(value))
-		}
+	// the runtime may also be set in the kraken config file
+	dockerClient.Runtime = krakenConfig.GetString("runtime")
+	if err := dockerClient.resolveRuntime(); err != nil {
+		return nil, err
+	}
 
-		if _, err := os.Stat(os.ExpandEnv(reflectedString)); err == nil {
-			if filepath.IsAbs(os.ExpandEnv(reflectedString)) {
-				for _, bind := range hostConfig.Binds {
-					if bind == os.ExpandEnv(reflectedString)+":"+os.ExpandEnv(reflectedString) {
-						return
-					}
-				}
-				hostConfig.Binds = append(hostConfig.Binds, os.ExpandEnv(reflectedString)+":"+os.ExpandEnv(reflectedString))
-			}
-		}
-	default:
+	enabled, err := tlsEnabled()
+	if err != nil {
+		return nil, err
 	}
-}
+	dockerClient.TLSEnabled = enabled
 
-func getClient() (*client.Client, error) {
-	var httpClient *http.Client
+	if verbosity {
+		fmt.Printf("Using %s runtime at %s \n", dockerClient.Runtime, dockerClient.DockerHost)
+	}
 
 	if dockerClient.isInheritedFromEnvironment() {
 		// Rely on Docker's own standard environment handling.
@@ -226,7 +200,7 @@ func getClient() (*client.Client, error) {
 	return client.NewClient(dockerClient.DockerHost, dockerClient.DockerAPIVersion, httpClient, headers)
 }
 
-func getAuthConfig64(ctx context.Context, cli *client.Client) (string, error) {
+func getAuthConfig64(ctx context.Context, rt ContainerRuntime) (string, error) {
 	authConfig := types.AuthConfig{}
 	if len(userName) > 0 && len(password) > 0 {
 		imageParts := strings.Split(containerImage, "/")
@@ -240,7 +214,7 @@ func getAuthConfig64(ctx context.Context, cli *client.Client) (string, error) {
 		authConfig.Username = userName
 		authConfig.Password = password
 
-		_, err := cli.RegistryLogin(ctx, authConfig)
+		_, err := rt.RegistryLogin(ctx, authConfig)
 		if err != nil {
 			return "", nil
 		}
@@ -249,7 +223,40 @@ func getAuthConfig64(ctx context.Context, cli *client.Client) (string, error) {
 	return base64EncodeAuth(authConfig)
 }
 
-func pullImage(ctx context.Context, cli *client.Client, base64Auth string) error {
+// image pull policies
+const (
+	pullAlways  string = "always"
+	pullMissing string = "missing"
+	pullNever   string = "never"
+)
+
+// ensureImage makes containerImage available to rt according to the configured pull policy.
+// Only 'always', the default, and 'missing' without a local copy talk to the registry.
+func ensureImage(ctx context.Context, rt ContainerRuntime) error {
+	switch policy := krakenConfig.GetString("container.pull"); policy {
+	case "", pullAlways:
+	case pullMissing, pullNever:
+		_, err := rt.ImageInspect(ctx, containerImage)
+		if err == nil {
+			return nil
+		}
+
+		if policy == pullNever {
+			return fmt.Errorf("image '%s' is not available locally and the pull policy is '%s': %v", containerImage, policy, err)
+		}
+	default:
+		return fmt.Errorf("unsupported pull policy '%s', use one of: %s, %s, %s", policy, pullAlways, pullMissing, pullNever)
+	}
+
+	authConfig64, err := getAuthConfig64(ctx, rt)
+	if err != nil {
+		return err
+	}
+
+	return pullImage(ctx, rt, authConfig64)
+}
+
+func pullImage(ctx context.Context, rt ContainerRuntime, base64Auth string) error {
 
 	pullOpts := types.ImagePullOptions{
 		RegistryAuth:  base64Auth,
@@ -257,82 +264,263 @@ func pullImage(ctx context.Context, cli *client.Client, base64Auth string) error
 		PrivilegeFunc: nil,
 	}
 
-	pullResponseBody, err := cli.ImagePull(ctx, containerImage, pullOpts)
+	pullResponseBody, err := rt.ImagePull(ctx, containerImage, pullOpts)
 	if err != nil {
 		return err
 	}
 
 	defer Close(pullResponseBody)
 
-	// wait until the image download is finished
+	progress := newPullProgress(containerImage, os.Stdout, isTerminal(os.Stdout))
+	// the layer progress replaces the spinner once there is any
+	progress.onStart = terminalSpinner.Stop
+
+	// wait until the image download is finished, any message can carry an error
 	dec := json.NewDecoder(pullResponseBody)
-	m := map[string]interface{}{}
 	for {
+		var m pullMessage
 		if err := dec.Decode(&m); err != nil {
 			if err == io.EOF {
 				break
 			}
 			return err
 		}
-	}
 
-	// if the final stream object contained an error
-	if errMsg, ok := m["error"]; ok {
-		return fmt.Errorf("%v", errMsg)
+		if err := m.err(); err != nil {
+			return err
+		}
+
+		progress.update(m, time.Now())
 	}
+
+	progress.finish(time.Now())
 	return nil
 }
 
-func containerAction(ctx context.Context, cli *client.Client, command []string, krakenlibconfig string) (types.ContainerCreateResponse, int, func(), error) {
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd())
+}
+
+// labels identifying the cluster and action a kraken-lib container was started for, and
+// the kraken process that started it and cleans it up
+const (
+	clusterLabel   string = "io.cnct.kraken.cluster"
+	actionLabel    string = "io.cnct.kraken.action"
+	ownerHostLabel string = "io.cnct.kraken.owner.host"
+	ownerPIDLabel  string = "io.cnct.kraken.owner.pid"
+)
+
+// containerLabels are the labels of the kraken-lib container of clusterName for action.
+func containerLabels(clusterName string, action string) map[string]string {
+	hostname, _ := os.Hostname()
+
+	return map[string]string{
+		clusterLabel:   clusterName,
+		actionLabel:    action,
+		ownerHostLabel: hostname,
+		ownerPIDLabel:  strconv.Itoa(os.Getpid()),
+	}
+}
+
+// ownerGone reports whether the kraken process that started a container with labels is
+// known to be gone, so that nobody else is left to clean the container up. Like locks,
+// owners on other hosts cannot be checked and are never gone.
+func ownerGone(labels map[string]string) bool {
+	pid, err := strconv.Atoi(labels[ownerPIDLabel])
+	if err != nil {
+		return false
+	}
+
+	owner := &clusterLock{PID: pid, Host: labels[ownerHostLabel]}
+	return owner.isStale()
+}
+
+// removeContainerHint tells the user how to remove the container named name with the
+// runtime kraken uses.
+func removeContainerHint(name string) string {
+	if dockerClient.Runtime == "" {
+		return "remove the container " + name
+	}
+
+	return fmt.Sprintf("remove it with '%s rm -f %s'", dockerClient.Runtime, name)
+}
+
+func krakenlibContainerName(clusterName string) string {
+	return "krakenlib" + clusterName
+}
+
+// containerAction runs command in a kraken-lib container for action. The output of the
+// container is written to out while it runs, and echoed to the terminal in verbose mode
+// and, for cluster actions and tool commands, to the --log-path file. The ansible events of playbooks go to progress, if any, and
+// stop the container when a stage runs out of its budget, with a *timeoutError. Tool
+// commands pass stdio to stream the output and forward stdin, nil for other actions.
+func containerAction(ctx context.Context, rt ContainerRuntime, action string, command []string, krakenlibconfig string, out io.Writer, progress *stageProgress, stdio *containerStdio) (types.ContainerCreateResponse, int, func(), error) {
 	var containerResponse types.ContainerCreateResponse
 
-	hostConfig, configEnvs := makeMounts(krakenlibconfig)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	watch := newStageWatch(stageTimeouts(), cancel)
+	defer watch.Stop()
+
+	hostConfig, configEnvs, err := makeMounts(krakenlibconfig)
+	if err != nil {
+		return containerResponse, -1, nil, err
+	}
+
+	command = withAnsibleForks(command)
+	if len(command) > 0 && command[0] == "ansible-playbook" {
+		eventEnvs, err := ansibleEventEnvironment()
+		if err != nil {
+			return containerResponse, -1, nil, err
+		}
+		configEnvs = append(configEnvs, eventEnvs...)
+	}
+
+	user, _, err := containerUser()
+	if err != nil {
+		return containerResponse, -1, nil, err
+	}
+	configEnvs = append(configEnvs, containerUserEnvironment(user)...)
+
+	extraEnvs, err := extraEnvironment()
+	if err != nil {
+		return containerResponse, -1, nil, err
+	}
+	envs := mergeEnvironment(containerEnvironment(), configEnvs, extraEnvs)
+
+	if verbosity {
+		fmt.Printf("Running kraken-lib as user %s \n", user)
+		if settings := describeContainerSettings(hostConfig); len(settings) > 0 {
+			fmt.Printf("Container settings: %s \n", strings.Join(settings, ", "))
+		}
+		fmt.Printf("Container environment: %s \n", strings.Join(environmentKeys(envs), ", "))
+		fmt.Printf("Container mounts: %s \n", strings.Join(hostConfig.Binds, ", "))
+	}
+
 	containerConfig := &container.Config{
 		Image:        containerImage,
-		Env:          append(containerEnvironment(), configEnvs...),
+		User:         user,
+		Env:          envs,
 		Cmd:          command,
 		AttachStdout: true,
-		Tty:          true,
+		AttachStderr: true,
+	}
+	if stdio != nil {
+		stdio.configure(containerConfig)
 	}
 
 	// ^[\\w]+[\\w-. ]*[\\w]+$ is the name requirement for docker containers as of 1.13.0
 	//  clusterName can be empty as a valid thing when a user is generating a config so the
 	//  hardcoded base portion of the name must satisfy the above regex.
 	clusterName := getFirstClusterName()
-	resp, err := cli.ContainerCreate(ctx, containerConfig, hostConfig, nil, "krakenlib"+clusterName)
+	containerName := krakenlibContainerName(clusterName)
+	containerConfig.Labels = containerLabels(clusterName, action)
+	resp, err := rt.ContainerCreate(ctx, containerConfig, hostConfig, containerName)
 	if err != nil {
+		if strings.Contains(err.Error(), "Conflict") {
+			err = fmt.Errorf("a kraken-lib container named %s already exists: another kraken command may be running against cluster '%s', "+
+				"or a previous run left it behind (%s)", containerName, clusterName, removeContainerHint(containerName))
+		}
 		return containerResponse, -1, nil, err
 	}
 
-	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		return containerResponse, -1, nil, err
+	handleEvent := watch.handle
+	if progress != nil {
+		handleEvent = func(e ansibleEvent) {
+			progress.handle(e)
+			watch.handle(e)
+		}
 	}
 
-	if verbosity {
-		streamLogs(getContext(), cli, resp)
+	var echoOut, echoErr io.Writer
+	switch {
+	case stdio != nil:
+		echoOut, echoErr = stdio.stdout, stdio.stderr
+	case verbosity:
+		echoOut, echoErr = os.Stdout, os.Stderr
 	}
 
-	statusCode, err := cli.ContainerWait(ctx, resp.ID)
+	// only cluster actions and tool commands are logged, not the containers kraken runs
+	// for itself, such as looking up the kubernetes version for helm
+	output, err := newActionOutput(out, handleEvent, echoOut, echoErr, progress != nil || stdio != nil)
 	if err != nil {
+		return containerResponse, -1, nil, err
+	}
+	defer Close(output)
+
+	// a tool container is attached before it starts, so none of its output or input is lost
+	var logs *logStream
+	if stdio != nil {
+		if logs, err = stdio.attach(rt, resp, output.stdout, output.stderr); err != nil {
+			return containerResponse, -1, nil, err
+		}
+	}
+
+	if err := rt.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		if logs != nil {
+			logs.reader.Close()
+		}
+		return containerResponse, -1, nil, err
+	}
+
+	if stdio != nil {
+		// restores the terminal before anything else is printed
+		defer stdio.start(rt, resp)()
+	} else if logs, err = followLogs(rt, resp, output.stdout, output.stderr); err != nil {
+		return containerResponse, -1, nil, err
+	}
+
+	// from here on interrupts go to the container instead of killing kraken and orphaning it
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, interruptSignals...)
+	defer signal.Stop(signals)
+
+	waitC := make(chan waitResult, 1)
+	go func() {
+		statusCode, err := rt.ContainerWait(ctx, resp.ID)
+		waitC <- waitResult{statusCode, err}
+	}()
+
+	var result waitResult
+	select {
+	case result = <-waitC:
+	case sig := <-signals:
+		if progress != nil {
+			progress.Stop("")
+		}
+		interrupted := interruptContainer(rt, resp, sig, signals, waitC)
+		logs.wait(killWaitPeriod)
+		return resp, interrupted.exitCode(), containerRenameOrRemove(rt, resp, clusterName, false, true), interrupted
+	}
+
+	if err := logs.wait(killWaitPeriod); err != nil && result.err == nil {
+		fmt.Printf("Error following kraken-lib logs: %s \n", err)
+	}
+
+	if result.err != nil {
 		select {
 		case <-ctx.Done():
-			fmt.Println("Action timed out!")
-			return resp, 1, containerRenameOrRemove(cli, resp, clusterName, true, true), nil
+			if progress != nil {
+				progress.Stop("")
+			}
+			return resp, 1, containerRenameOrRemove(rt, resp, clusterName, true, true), watch.timeout(action, actionTimeoutFor(action))
 		default:
-			return containerResponse, -1, nil, err
+			return containerResponse, -1, nil, result.err
 		}
 	}
 
-	return resp, statusCode, containerRenameOrRemove(cli, resp, clusterName, false, false), nil
+	return resp, result.statusCode, containerRenameOrRemove(rt, resp, clusterName, false, false), nil
 }
 
-func containerRenameOrRemove(cli *client.Client, resp types.ContainerCreateResponse, clusterName string, doKill bool, forceRemove bool) func() {
+func containerRenameOrRemove(rt ContainerRuntime, resp types.ContainerCreateResponse, clusterName string, doKill bool, forceRemove bool) func() {
 	return func() {
 		var err error
 
 		if keepAlive {
 			if doKill {
-				if err = cli.ContainerKill(getContext(), resp.ID, "KILL"); err != nil {
+				if err = rt.ContainerKill(getContext(), resp.ID, "KILL"); err != nil {
 					log.Fatalf("Error clean doing container renaming or removing: %s", err)
 				}
 			}
@@ -340,13 +528,13 @@ func containerRenameOrRemove(cli *client.Client, resp types.ContainerCreateRespo
 			oldContainerName := fmt.Sprintf("k2-%s", clusterName)
 			newContainerName := fmt.Sprintf("k2-%s", namesgenerator.GetRandomName(1))
 
-			err = cli.ContainerRename(getContext(), resp.ID, newContainerName)
+			err = rt.ContainerRename(getContext(), resp.ID, newContainerName)
 			if err == nil {
 				fmt.Printf("Renamed %s to %s \n", oldContainerName, newContainerName)
 			}
 		} else {
 			removeOpts := types.ContainerRemoveOptions{RemoveVolumes: false, RemoveLinks: false, Force: forceRemove}
-			err = cli.ContainerRemove(getContext(), resp.ID, removeOpts)
+			err = rt.ContainerRemove(getContext(), resp.ID, removeOpts)
 		}
 
 		if err != nil {
@@ -359,46 +547,6 @@ func getContext() context.Context {
 	return context.Background()
 }
 
-func getTimedContext() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), time.Duration(actionTimeout)*time.Second)
-}
-
-func writeLog(logFilePath string, out []byte) error {
-	var fileHandle *os.File
-
-	_, err := os.Stat(logFilePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-
-			// make sure path exists
-			err = os.MkdirAll(filepath.Dir(logFilePath), 0777)
-			if err != nil {
-				return err
-			}
-
-			// check if a valid file path
-			var d []byte
-
-			if err := ioutil.WriteFile(logFilePath, d, 0644); err != nil {
-				return err
-			}
-
-			os.Remove(logFilePath)
-
-			fileHandle, err = os.Create(logFilePath)
-			if err != nil {
-				return err
-			}
-		} else {
-			fileHandle, err = os.OpenFile("test.txt", os.O_RDWR, 0666)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	defer Close(fileHandle)
-
-	_, err = fileHandle.Write(out)
-	return err
+func getTimedContext(action string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), actionTimeoutFor(action))
 }
@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/spf13/viper"
 )
 
 func TestAddEnvironmentVarIfNotEmpty(t *testing.T) {
@@ -57,3 +63,64 @@ func TestHelmOverrideEnv(t *testing.T) {
 		t.Errorf("name coversion failed, got: %s, want: %s.", correctName, "helm_override_test_123")
 	}
 }
+
+func TestContainerNameConflict(t *testing.T) {
+	output, err := ioutil.TempDir("", "kraken-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+	defer useOutputLocation(output)()
+
+	defer func(original DockerClientConfig) { dockerClient = original }(dockerClient)
+	dockerClient.Runtime = runtimePodman
+
+	rt := newFakeRuntime()
+	rt.CreateErr = errors.New("Conflict. The container name is already in use")
+	defer useFakeRuntime(rt)()
+
+	if _, err := runContainerCommand(nil, rt, []string{"true"}, nil); err == nil || !strings.Contains(err.Error(), "'podman rm -f krakenlib") {
+		t.Error("Expected the conflict to be explained with the podman command, got", err)
+	}
+
+	dockerClient.Runtime = ""
+	if _, err := runContainerCommand(nil, rt, []string{"true"}, nil); err == nil || !strings.Contains(err.Error(), "remove the container krakenlib") {
+		t.Error("Expected the conflict to be explained without a runtime command, got", err)
+	}
+}
+
+func TestTLSEnabled(t *testing.T) {
+	defer func(original *viper.Viper) { krakenConfig = original }(krakenConfig)
+
+	readConfig := func(config string) {
+		krakenConfig = viper.New()
+		krakenConfig.SetConfigType("yaml")
+		if err := krakenConfig.ReadConfig(bytes.NewBufferString(config)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configs := map[string]bool{
+		"tls:\n  enabled: true\n  caBundle: /etc/ssl/corp.pem\n": true,
+		"tls:\n  caBundle: /etc/ssl/corp.pem\n":                  false,
+		"tls: true\n":                                            true,
+		"runtime: docker\n":                                      false,
+	}
+	for config, expected := range configs {
+		readConfig(config)
+		if enabled, err := tlsEnabled(); err != nil || enabled != expected {
+			t.Errorf("Expected tls %t for %q, got %t %v", expected, config, enabled, err)
+		}
+	}
+
+	// the CA bundle sits next to the boolean
+	readConfig("tls:\n  enabled: true\n  caBundle: /etc/ssl/corp.pem\n")
+	if bundle := krakenConfig.GetString("tls.caBundle"); bundle != "/etc/ssl/corp.pem" {
+		t.Error("Expected the CA bundle next to tls.enabled, got", bundle)
+	}
+
+	readConfig("tls: [corp.pem]\n")
+	if _, err := tlsEnabled(); err == nil || !strings.Contains(err.Error(), "tls.enabled") {
+		t.Error("Expected an invalid tls setting to be explained, got", err)
+	}
+}
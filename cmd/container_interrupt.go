@@ -0,0 +1,108 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	// how long the container gets to act on a forwarded signal before it is killed
+	interruptGracePeriod = 30 * time.Second
+	// how long to wait for a killed container to report its exit
+	killWaitPeriod = 10 * time.Second
+)
+
+// interruptSignals are trapped while a container action runs and forwarded to the container.
+var interruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// interruptedError is returned by container actions stopped by a signal.
+type interruptedError struct {
+	signal os.Signal
+	stage  string
+}
+
+func (e *interruptedError) Error() string {
+	if e.stage == "" {
+		return fmt.Sprintf("Interrupted by %s", signalName(e.signal))
+	}
+
+	return fmt.Sprintf("Interrupted by %s during stage '%s'", signalName(e.signal), e.stage)
+}
+
+// exitCode follows the shell convention of 128 + signal number.
+func (e *interruptedError) exitCode() int {
+	if s, ok := e.signal.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+
+	return 130
+}
+
+func signalName(sig os.Signal) string {
+	if sig == os.Interrupt {
+		return "SIGINT"
+	}
+
+	return "SIGTERM"
+}
+
+type waitResult struct {
+	statusCode int
+	err        error
+}
+
+// interruptContainer forwards sig to the container and waits out the grace period for it
+// to stop. A second signal, or the end of the grace period, kills the container.
+func interruptContainer(rt ContainerRuntime, resp types.ContainerCreateResponse, sig os.Signal, signals <-chan os.Signal, waitC <-chan waitResult) *interruptedError {
+	terminalSpinner.Stop()
+	fmt.Printf("\nReceived %s, stopping kraken-lib (waiting up to %s, interrupt again to kill it)\n", signalName(sig), interruptGracePeriod)
+
+	kill := func(reason string) {
+		fmt.Println(reason)
+		if err := rt.ContainerKill(getContext(), resp.ID, "KILL"); err != nil {
+			fmt.Printf("Error killing kraken-lib container: %s \n", err)
+		}
+
+		select {
+		case <-waitC:
+		case <-time.After(killWaitPeriod):
+		}
+	}
+
+	if err := rt.ContainerKill(getContext(), resp.ID, signalName(sig)); err != nil {
+		kill(fmt.Sprintf("Could not forward %s (%s), killing kraken-lib", signalName(sig), err))
+	} else {
+		select {
+		case <-waitC:
+		case <-signals:
+			kill("Killing kraken-lib")
+		case <-time.After(interruptGracePeriod):
+			kill("kraken-lib did not stop in time, killing it")
+		}
+	}
+
+	interrupted := &interruptedError{signal: sig}
+	if out, err := printContainerLogs(getContext(), rt, resp); err == nil {
+		interrupted.stage = lastStage(out)
+	}
+
+	return interrupted
+}
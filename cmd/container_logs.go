@@ -0,0 +1,246 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// streams of a multiplexed log, as in the header of each of its frames
+const (
+	streamStdin  byte = 0
+	streamStdout byte = 1
+	streamStderr byte = 2
+)
+
+// logFrameHeaderSize is the size of the header preceding every frame of a multiplexed log:
+// the stream, three zero bytes and the big endian uint32 size of the frame.
+const logFrameHeaderSize = 8
+
+// demuxLogs copies the logs of a container without a TTY to stdout and stderr, splitting
+// the frames of the multiplexed stream. Logs of a container with a TTY are not framed,
+// and are copied to stdout as they are.
+func demuxLogs(src io.Reader, stdout io.Writer, stderr io.Writer) error {
+	reader := bufio.NewReader(src)
+
+	header, err := reader.Peek(logFrameHeaderSize)
+	if err == io.EOF && len(header) == 0 {
+		return nil
+	}
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if !isLogFrameHeader(header) {
+		_, err := io.Copy(stdout, reader)
+		return err
+	}
+
+	header = make([]byte, logFrameHeaderSize)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		out := stdout
+		if header[0] == streamStderr {
+			out = stderr
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(out, reader, size); err != nil {
+			return err
+		}
+	}
+}
+
+func isLogFrameHeader(header []byte) bool {
+	if len(header) < logFrameHeaderSize || header[0] > streamStderr {
+		return false
+	}
+
+	return header[1] == 0 && header[2] == 0 && header[3] == 0
+}
+
+// logFrameWriter writes everything as frames of one stream of a multiplexed log.
+type logFrameWriter struct {
+	out    io.Writer
+	stream byte
+}
+
+func (w *logFrameWriter) Write(p []byte) (int, error) {
+	frame := make([]byte, logFrameHeaderSize, logFrameHeaderSize+len(p))
+	frame[0] = w.stream
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(p)))
+
+	if _, err := w.out.Write(append(frame, p...)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// logStream follows the logs of a container for as long as it runs.
+type logStream struct {
+	reader io.ReadCloser
+	done   chan struct{}
+	err    error
+}
+
+// followLogs copies the logs of the container to stdout and stderr as they are written,
+// until the container exits or the stream is stopped.
+func followLogs(rt ContainerRuntime, resp types.ContainerCreateResponse, stdout io.Writer, stderr io.Writer) (*logStream, error) {
+	// the stream lasts as long as the container, it must not share the action's deadline
+	containerLogOpts := types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Follow: true}
+	reader, err := rt.ContainerLogs(getContext(), resp.ID, containerLogOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &logStream{reader: reader, done: make(chan struct{})}
+	go func() {
+		defer close(stream.done)
+		stream.err = demuxLogs(reader, stdout, stderr)
+	}()
+
+	return stream, nil
+}
+
+// wait waits for the end of the logs, at most timeout once the container is gone, and
+// then stops following them.
+func (s *logStream) wait(timeout time.Duration) error {
+	select {
+	case <-s.done:
+	case <-time.After(timeout):
+	}
+
+	// closing unblocks a reader still following a container that did not exit
+	s.reader.Close()
+	<-s.done
+
+	return s.err
+}
+
+// actionOutput gathers where the output of a container action goes: the caller's buffer,
+// echoOut and echoErr if set and, when logged, the log of the run being recorded and the
+// --log-path file. Ansible events are taken out of stderr and handed to handleEvent instead.
+type actionOutput struct {
+	stdout   io.Writer
+	stderr   io.Writer
+	events   *ansibleEventFilter
+	logFiles []*os.File
+}
+
+func newActionOutput(out io.Writer, handleEvent func(ansibleEvent), echoOut io.Writer, echoErr io.Writer, logged bool) (*actionOutput, error) {
+	// stdout and stderr are written from one goroutine, so their order is kept in out
+	stdout := []io.Writer{out}
+	stderr := []io.Writer{out}
+
+	if echoOut != nil {
+		stdout = append(stdout, echoOut)
+	}
+	if echoErr != nil {
+		stderr = append(stderr, echoErr)
+	}
+
+	var logFilePaths []string
+	if logged && currentRun != nil {
+		logFilePaths = append(logFilePaths, currentRun.LogFile)
+	}
+	if logFilePath := strings.TrimSpace(logPath); logged && len(logFilePath) > 0 {
+		logFilePaths = append(logFilePaths, logFilePath)
+	}
+
+	output := &actionOutput{}
+	for _, logFilePath := range logFilePaths {
+		logFile, err := openLogFile(logFilePath)
+		if err != nil {
+			output.closeLogFiles()
+			return nil, err
+		}
+
+		output.logFiles = append(output.logFiles, logFile)
+		stdout = append(stdout, logFile)
+		stderr = append(stderr, logFile)
+	}
+
+	output.stdout = io.MultiWriter(stdout...)
+	output.events = &ansibleEventFilter{out: io.MultiWriter(stderr...), handle: handleEvent}
+	output.stderr = output.events
+
+	return output, nil
+}
+
+func (o *actionOutput) Close() error {
+	if err := o.events.Flush(); err != nil {
+		o.closeLogFiles()
+		return err
+	}
+
+	return o.closeLogFiles()
+}
+
+func (o *actionOutput) closeLogFiles() error {
+	var err error
+	for _, logFile := range o.logFiles {
+		if closeErr := logFile.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// openedLogFiles are the log files already written by this command.
+var openedLogFiles = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: map[string]bool{}}
+
+// openLogFile opens the log file at logFilePath and creates the folders leading to it. The
+// first container of a command truncates the file, later ones, such as retries, append to it.
+func openLogFile(logFilePath string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(logFilePath), 0755); err != nil {
+		return nil, err
+	}
+
+	openedLogFiles.Lock()
+	defer openedLogFiles.Unlock()
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !openedLogFiles.paths[logFilePath] {
+		flags |= os.O_TRUNC
+	}
+
+	logFile, err := os.OpenFile(logFilePath, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	openedLogFiles.paths[logFilePath] = true
+
+	return logFile, nil
+}
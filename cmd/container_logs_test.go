@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestDemuxLogs(t *testing.T) {
+	var framed bytes.Buffer
+	(&logFrameWriter{out: &framed, stream: streamStdout}).Write([]byte("TASK [kraken.config : Load config]\n"))
+	(&logFrameWriter{out: &framed, stream: streamStderr}).Write([]byte("[WARNING]: deprecated\n"))
+	(&logFrameWriter{out: &framed, stream: streamStdout}).Write([]byte("ok: [localhost]\n"))
+
+	var stdout, stderr bytes.Buffer
+	if err := demuxLogs(&framed, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout.String() != "TASK [kraken.config : Load config]\nok: [localhost]\n" {
+		t.Error("Expected the stdout frames on stdout, got", stdout.String())
+	}
+
+	if stderr.String() != "[WARNING]: deprecated\n" {
+		t.Error("Expected the stderr frames on stderr, got", stderr.String())
+	}
+
+	// logs of a container with a TTY are copied as they are
+	stdout.Reset()
+	if err := demuxLogs(strings.NewReader("PLAY RECAP\r\n"), &stdout, &stderr); err != nil || stdout.String() != "PLAY RECAP\r\n" {
+		t.Error("Expected unframed logs to be copied to stdout, got", stdout.String(), err)
+	}
+}
+
+func TestFollowLogs(t *testing.T) {
+	output := newLogBuffer()
+	rt := &nativeRuntime{processes: map[string]*nativeProcess{"native-1": {output: output}}}
+
+	var stdout, stderr bytes.Buffer
+	logs, err := followLogs(rt, types.ContainerCreateResponse{ID: "native-1"}, &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stream keeps following well past the time the first lines are written
+	(&logFrameWriter{out: output, stream: streamStdout}).Write([]byte("first\n"))
+	time.Sleep(50 * time.Millisecond)
+	(&logFrameWriter{out: output, stream: streamStderr}).Write([]byte("second\n"))
+	output.Close()
+
+	if err := logs.wait(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout.String() != "first\n" || stderr.String() != "second\n" {
+		t.Error("Expected all of the logs, got stdout", stdout.String(), "stderr", stderr.String())
+	}
+
+	// a stream still following a process that does not exit is stopped
+	running := newLogBuffer()
+	rt.processes["native-2"] = &nativeProcess{output: running}
+	logs, err = followLogs(rt, types.ContainerCreateResponse{ID: "native-2"}, &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := logs.wait(10 * time.Millisecond); err != nil {
+		t.Error("Expected a stopped stream to end without error, got", err)
+	}
+}
+
+func TestActionOutputLogPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kraken-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	originalLogPath := logPath
+	logPath = filepath.Join(dir, "logs", "up.log")
+	defer func() { logPath = originalLogPath }()
+
+	var out bytes.Buffer
+	var events []ansibleEvent
+	output, err := newActionOutput(&out, func(e ansibleEvent) { events = append(events, e) }, nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output.stdout.Write([]byte("TASK [kraken.config : Load config]\n"))
+	written, err := ioutil.ReadFile(logPath)
+	if err != nil || string(written) != "TASK [kraken.config : Load config]\n" {
+		t.Error("Expected the log file to be written as output comes in, got", string(written), err)
+	}
+
+	output.stderr.Write([]byte(ansibleEventPrefix + `{"event":"result","status":"failed"}` + "\nfatal: [localhost]: FAILED!\n"))
+	output.Close()
+
+	if len(events) != 1 || events[0].Status != "failed" {
+		t.Error("Expected the ansible event to be handled, got", events)
+	}
+
+	if written, _ := ioutil.ReadFile(logPath); strings.Contains(string(written), ansibleEventPrefix) {
+		t.Error("Expected the log file to only get the raw log, got", string(written))
+	}
+
+	if out.String() != "TASK [kraken.config : Load config]\nfatal: [localhost]: FAILED!\n" {
+		t.Error("Expected stdout and stderr in order in the output, got", out.String())
+	}
+}
+
+func TestLogPathKeepsEveryAttempt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kraken-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer useOutputLocation(dir)()
+
+	originalLogPath := logPath
+	logPath = filepath.Join(dir, "up.log")
+	defer func() { logPath = originalLogPath }()
+
+	if err := ioutil.WriteFile(logPath, []byte("previous command\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	attempt := 0
+	rt := newFakeRuntime()
+	rt.Run = func(config *container.Config) (string, int) {
+		if config.Cmd[0] == "test" {
+			return "helper\n", 0
+		}
+		attempt++
+		return fmt.Sprintf("attempt %d\n", attempt), 2
+	}
+	defer useFakeRuntime(rt)()
+
+	ignore := func(out []byte) {}
+	for i := 0; i < 2; i++ {
+		if _, err := runKrakenLibCommand(actionUp, "testing ", []string{"ansible-playbook", "ansible/up.yaml"}, "", ignore, ignore); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := runContainerCommand(nil, rt, []string{"test", "-f", "/opt/helm"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if written, err := ioutil.ReadFile(logPath); err != nil || string(written) != "attempt 1\nattempt 2\n" {
+		t.Error("Expected the log of every attempt and none of the helper container, got", string(written), err)
+	}
+}
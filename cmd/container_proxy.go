@@ -0,0 +1,82 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// proxy variables forwarded to kraken-lib, in both of the cases tools look them up in
+var proxyVariables = []string{
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"NO_PROXY",
+	"http_proxy",
+	"https_proxy",
+	"no_proxy",
+}
+
+// variables pointing openssl, python requests and the AWS tools at a CA bundle
+var caBundleVariables = []string{
+	"SSL_CERT_FILE",
+	"REQUESTS_CA_BUNDLE",
+	"AWS_CA_BUNDLE",
+}
+
+var caBundle string
+
+// caBundlePath is the absolute path of the CA bundle set with --ca-bundle or 'tls.caBundle'
+// in kraken.config, if any.
+func caBundlePath() (string, error) {
+	bundle := krakenConfig.GetString("tls.caBundle")
+	if bundle == "" {
+		return "", nil
+	}
+
+	bundle, err := filepath.Abs(os.ExpandEnv(bundle))
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(bundle)
+	if err != nil {
+		return "", fmt.Errorf("cannot use CA bundle: %v", err)
+	}
+
+	if info.IsDir() {
+		return "", fmt.Errorf("cannot use CA bundle: %s is a directory, not a PEM file", bundle)
+	}
+
+	return bundle, nil
+}
+
+// proxyEnvironment is the proxy and CA bundle environment of the host to pass on to kraken-lib.
+// The CA bundle is mounted at its host path, so the same variables work in native mode.
+func proxyEnvironment() []string {
+	var envs []string
+	for _, key := range proxyVariables {
+		envs = appendIfValueNotEmpty(envs, key)
+	}
+
+	if bundle, err := caBundlePath(); err == nil && bundle != "" {
+		for _, key := range caBundleVariables {
+			envs = append(envs, key+"="+bundle)
+		}
+	}
+
+	return envs
+}
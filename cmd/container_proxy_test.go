@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProxyEnvironment(t *testing.T) {
+	bundleDir, err := ioutil.TempDir("", "kraken-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bundleDir)
+
+	bundle := filepath.Join(bundleDir, "ca.pem")
+	if err := ioutil.WriteFile(bundle, []byte("-----BEGIN CERTIFICATE-----\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range proxyVariables {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Unsetenv(key)
+	}
+	os.Setenv("HTTPS_PROXY", "http://proxy.corp:3128")
+	os.Setenv("no_proxy", "localhost,.corp")
+
+	krakenConfig.Set("tls.caBundle", bundle)
+	defer krakenConfig.Set("tls.caBundle", "")
+
+	expected := map[string]bool{
+		"HTTPS_PROXY=http://proxy.corp:3128": true,
+		"no_proxy=localhost,.corp":           true,
+		"SSL_CERT_FILE=" + bundle:            true,
+		"REQUESTS_CA_BUNDLE=" + bundle:       true,
+		"AWS_CA_BUNDLE=" + bundle:            true,
+	}
+
+	envs := proxyEnvironment()
+	if len(envs) != len(expected) {
+		t.Error("Expected", len(expected), "variables, got", envs)
+	}
+	for _, env := range envs {
+		if !expected[env] {
+			t.Error("Unexpected variable", env)
+		}
+	}
+
+	krakenConfig.Set("tls.caBundle", bundleDir)
+	if _, err := caBundlePath(); err == nil {
+		t.Error("Expected an error for a CA bundle that is a directory")
+	}
+
+	krakenConfig.Set("tls.caBundle", filepath.Join(bundleDir, "missing.pem"))
+	if _, err := caBundlePath(); err == nil {
+		t.Error("Expected an error for a missing CA bundle")
+	}
+}
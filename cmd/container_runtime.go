@@ -0,0 +1,65 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"golang.org/x/net/context"
+)
+
+// ContainerRuntime is the set of container engine operations kraken needs in order to
+// run kraken-lib. The commands only ever talk to a ContainerRuntime, never to a
+// specific engine client, so that engines can be swapped and the helpers unit-tested.
+type ContainerRuntime interface {
+	RegistryLogin(ctx context.Context, auth types.AuthConfig) (types.AuthResponse, error)
+	ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error)
+	ImageInspect(ctx context.Context, ref string) (types.ImageInspect, error)
+	ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, containerName string) (types.ContainerCreateResponse, error)
+	ContainerAttach(ctx context.Context, containerID string, options types.ContainerAttachOptions) (types.HijackedResponse, error)
+	ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error
+	ContainerResize(ctx context.Context, containerID string, options types.ResizeOptions) error
+	ContainerWait(ctx context.Context, containerID string) (int, error)
+	ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error)
+	ContainerKill(ctx context.Context, containerID, signal string) error
+	ContainerRename(ctx context.Context, containerID, newContainerName string) error
+	ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error
+	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
+	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
+}
+
+const (
+	execModeContainer string = "container"
+	execModeNative    string = "native"
+)
+
+// newContainerRuntime constructs the runtime used by all container actions.
+// Tests replace it to run commands against an in-memory runtime.
+var newContainerRuntime = newConfiguredRuntime
+
+// newConfiguredRuntime picks the runtime for the configured execution mode.
+func newConfiguredRuntime() (ContainerRuntime, error) {
+	switch mode := krakenConfig.GetString("exec-mode"); mode {
+	case "", execModeContainer:
+		return newDockerRuntime()
+	case execModeNative:
+		return newNativeRuntime(krakenConfig.GetString("krakenlib-dir"))
+	default:
+		return nil, fmt.Errorf("unsupported execution mode '%s', use one of: %s, %s", mode, execModeContainer, execModeNative)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"golang.org/x/net/context"
+)
+
+// dockerRuntime is a ContainerRuntime backed by the Docker remote API.
+type dockerRuntime struct {
+	cli *client.Client
+}
+
+func newDockerRuntime() (ContainerRuntime, error) {
+	cli, err := getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return &dockerRuntime{cli: cli}, nil
+}
+
+func (d *dockerRuntime) RegistryLogin(ctx context.Context, auth types.AuthConfig) (types.AuthResponse, error) {
+	return d.cli.RegistryLogin(ctx, auth)
+}
+
+func (d *dockerRuntime) ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	return d.cli.ImagePull(ctx, ref, options)
+}
+
+func (d *dockerRuntime) ImageInspect(ctx context.Context, ref string) (types.ImageInspect, error) {
+	image, _, err := d.cli.ImageInspectWithRaw(ctx, ref)
+	return image, err
+}
+
+func (d *dockerRuntime) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, containerName string) (types.ContainerCreateResponse, error) {
+	return d.cli.ContainerCreate(ctx, config, hostConfig, nil, containerName)
+}
+
+func (d *dockerRuntime) ContainerAttach(ctx context.Context, containerID string, options types.ContainerAttachOptions) (types.HijackedResponse, error) {
+	return d.cli.ContainerAttach(ctx, containerID, options)
+}
+
+func (d *dockerRuntime) ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error {
+	return d.cli.ContainerStart(ctx, containerID, options)
+}
+
+func (d *dockerRuntime) ContainerResize(ctx context.Context, containerID string, options types.ResizeOptions) error {
+	return d.cli.ContainerResize(ctx, containerID, options)
+}
+
+func (d *dockerRuntime) ContainerWait(ctx context.Context, containerID string) (int, error) {
+	return d.cli.ContainerWait(ctx, containerID)
+}
+
+func (d *dockerRuntime) ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	return d.cli.ContainerLogs(ctx, containerID, options)
+}
+
+func (d *dockerRuntime) ContainerKill(ctx context.Context, containerID, signal string) error {
+	return d.cli.ContainerKill(ctx, containerID, signal)
+}
+
+func (d *dockerRuntime) ContainerRename(ctx context.Context, containerID, newContainerName string) error {
+	return d.cli.ContainerRename(ctx, containerID, newContainerName)
+}
+
+func (d *dockerRuntime) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	return d.cli.ContainerRemove(ctx, containerID, options)
+}
+
+func (d *dockerRuntime) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	return d.cli.ContainerInspect(ctx, containerID)
+}
+
+func (d *dockerRuntime) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	return d.cli.ContainerList(ctx, options)
+}
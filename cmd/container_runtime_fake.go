@@ -0,0 +1,337 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"golang.org/x/net/context"
+)
+
+// fakeRuntime is an in-memory ContainerRuntime. It never talks to a daemon: containers
+// "run" by calling Run with their config, which returns the output and exit code.
+type fakeRuntime struct {
+	sync.Mutex
+
+	// PullOutput is the JSON message stream returned by ImagePull.
+	PullOutput string
+	PullErr    error
+	CreateErr  error
+
+	// Run produces the output and exit code of a started container.
+	Run func(config *container.Config) (string, int)
+
+	// Images are the images present locally, by reference. Pulled images are added.
+	Images map[string]types.ImageInspect
+
+	Containers map[string]*fakeContainer
+	Pulled     []string
+	nextID     int
+}
+
+type fakeContainer struct {
+	ID         string
+	Name       string
+	Config     *container.Config
+	HostConfig *container.HostConfig
+	Output     string
+	ExitCode   int
+	Started    bool
+	Running    bool
+	Killed     bool
+	Removed    bool
+	// Stdin is what was written to the attached stdin of the container before it ran.
+	Stdin string
+	// Sizes are the sizes its TTY was given, in order.
+	Sizes []types.ResizeOptions
+
+	attachedStdin  io.Reader
+	attachedOutput *io.PipeWriter
+}
+
+func newFakeRuntime() *fakeRuntime {
+	return &fakeRuntime{
+		Images:     map[string]types.ImageInspect{},
+		Containers: map[string]*fakeContainer{},
+		Run: func(config *container.Config) (string, int) {
+			return "", 0
+		},
+	}
+}
+
+func (f *fakeRuntime) container(containerID string) (*fakeContainer, error) {
+	if c, ok := f.Containers[containerID]; ok && !c.Removed {
+		return c, nil
+	}
+
+	for _, c := range f.Containers {
+		if c.Name == containerID && !c.Removed {
+			return c, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Error: No such container: %s", containerID)
+}
+
+func (f *fakeRuntime) RegistryLogin(ctx context.Context, auth types.AuthConfig) (types.AuthResponse, error) {
+	return types.AuthResponse{Status: "Login Succeeded"}, nil
+}
+
+func (f *fakeRuntime) ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.PullErr != nil {
+		return nil, f.PullErr
+	}
+
+	f.Pulled = append(f.Pulled, ref)
+	f.Images[ref] = types.ImageInspect{ID: "sha256:" + ref}
+	return ioutil.NopCloser(strings.NewReader(f.PullOutput)), nil
+}
+
+func (f *fakeRuntime) ImageInspect(ctx context.Context, ref string) (types.ImageInspect, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	image, ok := f.Images[ref]
+	if !ok {
+		return types.ImageInspect{}, fmt.Errorf("Error: No such image: %s", ref)
+	}
+
+	return image, nil
+}
+
+func (f *fakeRuntime) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, containerName string) (types.ContainerCreateResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.CreateErr != nil {
+		return types.ContainerCreateResponse{}, f.CreateErr
+	}
+
+	for _, c := range f.Containers {
+		if containerName != "" && c.Name == containerName && !c.Removed {
+			return types.ContainerCreateResponse{}, fmt.Errorf("Error response from daemon: Conflict. The container name \"/%s\" is already in use by container %s", containerName, c.ID)
+		}
+	}
+
+	f.nextID++
+	id := fmt.Sprintf("fake%04d", f.nextID)
+	f.Containers[id] = &fakeContainer{ID: id, Name: containerName, Config: config, HostConfig: hostConfig}
+
+	return types.ContainerCreateResponse{ID: id}, nil
+}
+
+// ContainerAttach returns a connection streaming the output of the container once it
+// runs, and taking its stdin until the write side is closed.
+func (f *fakeRuntime) ContainerAttach(ctx context.Context, containerID string, options types.ContainerAttachOptions) (types.HijackedResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return types.HijackedResponse{}, err
+	}
+
+	outputReader, outputWriter := io.Pipe()
+	c.attachedOutput = outputWriter
+	conn := &streamConn{Reader: outputReader}
+	if options.Stdin {
+		stdinReader, stdinWriter := io.Pipe()
+		c.attachedStdin = stdinReader
+		conn.stdin = stdinWriter
+	}
+
+	return types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(conn)}, nil
+}
+
+func (f *fakeRuntime) ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error {
+	f.Lock()
+	defer f.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return err
+	}
+
+	c.Started = true
+	if c.attachedStdin != nil {
+		stdin, err := ioutil.ReadAll(c.attachedStdin)
+		if err != nil {
+			return err
+		}
+		c.Stdin = string(stdin)
+	}
+
+	c.Output, c.ExitCode = f.Run(c.Config)
+
+	if c.attachedOutput != nil {
+		go func(c *fakeContainer) {
+			if c.Config.Tty {
+				c.attachedOutput.Write([]byte(c.Output))
+			} else {
+				writeFakeOutput(c.attachedOutput, c.Output)
+			}
+			c.attachedOutput.Close()
+		}(c)
+	}
+
+	return nil
+}
+
+func (f *fakeRuntime) ContainerResize(ctx context.Context, containerID string, options types.ResizeOptions) error {
+	f.Lock()
+	defer f.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return err
+	}
+
+	c.Sizes = append(c.Sizes, options)
+	return nil
+}
+
+func (f *fakeRuntime) ContainerWait(ctx context.Context, containerID string) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return -1, err
+	}
+
+	return c.ExitCode, nil
+}
+
+func (f *fakeRuntime) ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Config.Tty || c.Output == "" {
+		return ioutil.NopCloser(strings.NewReader(c.Output)), nil
+	}
+
+	var framed bytes.Buffer
+	writeFakeOutput(&framed, c.Output)
+	return ioutil.NopCloser(&framed), nil
+}
+
+// writeFakeOutput multiplexes output as the logs of a container without a TTY: ansible
+// event lines on stderr, where the callback writes them, everything else on stdout.
+func writeFakeOutput(w io.Writer, output string) {
+	stdout := &logFrameWriter{out: w, stream: streamStdout}
+	stderr := &logFrameWriter{out: w, stream: streamStderr}
+
+	for _, line := range strings.SplitAfter(output, "\n") {
+		if strings.HasPrefix(line, ansibleEventPrefix) {
+			stderr.Write([]byte(line))
+		} else if line != "" {
+			stdout.Write([]byte(line))
+		}
+	}
+}
+
+func (f *fakeRuntime) ContainerKill(ctx context.Context, containerID, signal string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return err
+	}
+
+	c.Killed = true
+	return nil
+}
+
+func (f *fakeRuntime) ContainerRename(ctx context.Context, containerID, newContainerName string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return err
+	}
+
+	c.Name = newContainerName
+	return nil
+}
+
+func (f *fakeRuntime) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	f.Lock()
+	defer f.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return err
+	}
+
+	c.Removed = true
+	return nil
+}
+
+func (f *fakeRuntime) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	c, err := f.container(containerID)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    c.ID,
+			Name:  "/" + c.Name,
+			State: &types.ContainerState{Running: c.Running, ExitCode: c.ExitCode},
+		},
+		Config: c.Config,
+	}, nil
+}
+
+func (f *fakeRuntime) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	var containers []types.Container
+	for _, c := range f.Containers {
+		if c.Removed || (!options.All && !c.Running) {
+			continue
+		}
+
+		if !options.Filter.MatchKVList("label", c.Config.Labels) {
+			continue
+		}
+
+		containers = append(containers, types.Container{ID: c.ID, Names: []string{"/" + c.Name}, Labels: c.Config.Labels})
+	}
+
+	return containers, nil
+}
@@ -0,0 +1,458 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"golang.org/x/net/context"
+)
+
+// krakenlibImageRoot is where the kraken-lib checkout lives inside the kraken-lib image.
+const krakenlibImageRoot string = "/kraken/"
+
+// nativeRuntime is a ContainerRuntime that runs kraken-lib commands as local processes
+// against a kraken-lib checkout instead of inside the kraken-lib image. The binds planMounts
+// makes for the cluster config, the output folder and the paths it refers to map host
+// paths onto themselves, so the processes see the same paths a container would and need
+// no mounts at all. Mounts to other container paths, as --mount can make, are refused.
+type nativeRuntime struct {
+	sync.Mutex
+
+	krakenlibDir string
+	processes    map[string]*nativeProcess
+	nextID       int
+}
+
+type nativeProcess struct {
+	name   string
+	config *container.Config
+	cmd    *exec.Cmd
+	output *logBuffer
+	stdin  *os.File
+	done   chan struct{}
+	// exitCode is set by the goroutine waiting for the process, read it once done is closed
+	exitCode int
+}
+
+func newNativeRuntime(krakenlibDir string) (ContainerRuntime, error) {
+	if krakenlibDir == "" {
+		return nil, fmt.Errorf("--krakenlib-dir is required with --exec-mode=%s", execModeNative)
+	}
+
+	dir, err := filepath.Abs(os.ExpandEnv(krakenlibDir))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "ansible", "inventory", "localhost")); err != nil {
+		return nil, fmt.Errorf("%s does not look like a kraken-lib checkout: %v", dir, err)
+	}
+
+	return &nativeRuntime{krakenlibDir: dir, processes: map[string]*nativeProcess{}}, nil
+}
+
+func (n *nativeRuntime) process(containerID string) (*nativeProcess, error) {
+	if p, ok := n.processes[containerID]; ok {
+		return p, nil
+	}
+
+	for _, p := range n.processes {
+		if p.name == containerID {
+			return p, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no such process: %s", containerID)
+}
+
+// RegistryLogin is a no-op, there is no image to pull.
+func (n *nativeRuntime) RegistryLogin(ctx context.Context, auth types.AuthConfig) (types.AuthResponse, error) {
+	return types.AuthResponse{}, nil
+}
+
+// ImagePull returns an empty pull stream, the checkout is used as is.
+func (n *nativeRuntime) ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+// ImageInspect always succeeds, the checkout stands in for the image.
+func (n *nativeRuntime) ImageInspect(ctx context.Context, ref string) (types.ImageInspect, error) {
+	return types.ImageInspect{ID: n.krakenlibDir}, nil
+}
+
+func (n *nativeRuntime) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, containerName string) (types.ContainerCreateResponse, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	if len(config.Cmd) == 0 {
+		return types.ContainerCreateResponse{}, fmt.Errorf("no command to run")
+	}
+
+	if err := checkNativeBinds(hostConfig); err != nil {
+		return types.ContainerCreateResponse{}, err
+	}
+
+	for id, p := range n.processes {
+		if containerName != "" && p.name == containerName {
+			return types.ContainerCreateResponse{}, fmt.Errorf("Conflict. The name \"%s\" is already in use by process %s", containerName, id)
+		}
+	}
+
+	// paths into the image's kraken-lib checkout point into the local checkout instead
+	argv := make([]string, len(config.Cmd))
+	for i, arg := range config.Cmd {
+		if strings.HasPrefix(arg, krakenlibImageRoot) {
+			arg = filepath.Join(n.krakenlibDir, strings.TrimPrefix(arg, krakenlibImageRoot))
+		}
+		argv[i] = arg
+	}
+
+	output := newLogBuffer()
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Dir = n.krakenlibDir
+	cmd.Env = append(os.Environ(), config.Env...)
+	// output is multiplexed like the logs of a container without a TTY
+	cmd.Stdout = &logFrameWriter{out: output, stream: streamStdout}
+	cmd.Stderr = &logFrameWriter{out: output, stream: streamStderr}
+
+	n.nextID++
+	id := fmt.Sprintf("native-%d-%d", os.Getpid(), n.nextID)
+	n.processes[id] = &nativeProcess{name: containerName, config: config, cmd: cmd, output: output, done: make(chan struct{})}
+
+	return types.ContainerCreateResponse{ID: id}, nil
+}
+
+// checkNativeBinds refuses the binds of hostConfig that put a host path at another path,
+// processes see every host path where it is. A symbolic link resolving to its host path,
+// as planMounts makes them, is where it should be.
+func checkNativeBinds(hostConfig *container.HostConfig) error {
+	if hostConfig == nil {
+		return nil
+	}
+
+	for _, bind := range hostConfig.Binds {
+		parts := strings.SplitN(bind, ":", 3)
+		if len(parts) < 2 || parts[0] == parts[1] {
+			continue
+		}
+
+		if resolved, err := filepath.EvalSymlinks(parts[1]); err == nil && resolved == parts[0] {
+			continue
+		}
+
+		return fmt.Errorf("cannot mount %s at %s with --exec-mode=%s, processes only see host paths where they are", parts[0], parts[1], execModeNative)
+	}
+
+	return nil
+}
+
+// ContainerAttach follows the output of a process, and writes to its stdin when attached
+// to it before the process starts. Processes never get a TTY.
+func (n *nativeRuntime) ContainerAttach(ctx context.Context, containerID string, options types.ContainerAttachOptions) (types.HijackedResponse, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	p, err := n.process(containerID)
+	if err != nil {
+		return types.HijackedResponse{}, err
+	}
+
+	conn := &streamConn{Reader: p.output.NewReader(true)}
+	if options.Stdin {
+		if p.cmd.Process != nil {
+			return types.HijackedResponse{}, fmt.Errorf("process %s is already running, its stdin cannot be attached", containerID)
+		}
+
+		// a pipe is handed to the process as is, a reader would need copying until it closes
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return types.HijackedResponse{}, err
+		}
+		p.cmd.Stdin = reader
+		p.stdin = reader
+		conn.stdin = writer
+	}
+
+	return types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(conn)}, nil
+}
+
+func (n *nativeRuntime) ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error {
+	// held while starting, so that inspecting sees the process once it is set
+	n.Lock()
+	defer n.Unlock()
+
+	p, err := n.process(containerID)
+	if err != nil {
+		return err
+	}
+
+	err = p.cmd.Start()
+	if p.stdin != nil {
+		// the process has its own copy of the read end of its stdin now
+		p.stdin.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		err := p.cmd.Wait()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			p.exitCode = 1
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				p.exitCode = status.ExitStatus()
+			}
+		} else if err != nil {
+			fmt.Fprintf(&logFrameWriter{out: p.output, stream: streamStderr}, "%v\n", err)
+			p.exitCode = 1
+		}
+
+		p.output.Close()
+		close(p.done)
+	}()
+
+	return nil
+}
+
+// ContainerResize is a no-op, processes have no TTY to resize.
+func (n *nativeRuntime) ContainerResize(ctx context.Context, containerID string, options types.ResizeOptions) error {
+	return nil
+}
+
+func (n *nativeRuntime) ContainerWait(ctx context.Context, containerID string) (int, error) {
+	n.Lock()
+	p, err := n.process(containerID)
+	n.Unlock()
+	if err != nil {
+		return -1, err
+	}
+
+	select {
+	case <-p.done:
+		return p.exitCode, nil
+	case <-ctx.Done():
+		return -1, ctx.Err()
+	}
+}
+
+func (n *nativeRuntime) ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	p, err := n.process(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.output.NewReader(options.Follow), nil
+}
+
+func (n *nativeRuntime) ContainerKill(ctx context.Context, containerID, signal string) error {
+	n.Lock()
+	p, err := n.process(containerID)
+	var process *os.Process
+	if err == nil {
+		process = p.cmd.Process
+	}
+	n.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if process == nil {
+		return fmt.Errorf("process %s is not running", containerID)
+	}
+
+	switch strings.TrimPrefix(strings.ToUpper(signal), "SIG") {
+	case "INT":
+		return process.Signal(os.Interrupt)
+	case "TERM":
+		return process.Signal(syscall.SIGTERM)
+	default:
+		return process.Kill()
+	}
+}
+
+func (n *nativeRuntime) ContainerRename(ctx context.Context, containerID, newContainerName string) error {
+	n.Lock()
+	defer n.Unlock()
+
+	p, err := n.process(containerID)
+	if err != nil {
+		return err
+	}
+
+	p.name = newContainerName
+	return nil
+}
+
+func (n *nativeRuntime) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	n.Lock()
+	defer n.Unlock()
+
+	p, err := n.process(containerID)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-p.done:
+	default:
+		if !options.Force {
+			return fmt.Errorf("process %s is still running", containerID)
+		}
+		if p.cmd.Process != nil {
+			p.cmd.Process.Kill()
+		}
+	}
+
+	delete(n.processes, containerID)
+	return nil
+}
+
+func (p *nativeProcess) running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return p.cmd.Process != nil
+	}
+}
+
+// ContainerInspect only knows the processes started by this kraken invocation.
+func (n *nativeRuntime) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	p, err := n.process(containerID)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+
+	state := &types.ContainerState{Running: p.running()}
+	select {
+	case <-p.done:
+		state.ExitCode = p.exitCode
+	default:
+	}
+
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    containerID,
+			Name:  "/" + p.name,
+			State: state,
+		},
+		Config: p.config,
+	}, nil
+}
+
+// ContainerList only knows the processes started by this kraken invocation.
+func (n *nativeRuntime) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	var containers []types.Container
+	for id, p := range n.processes {
+		if (options.All || p.running()) && options.Filter.MatchKVList("label", p.config.Labels) {
+			containers = append(containers, types.Container{ID: id, Names: []string{"/" + p.name}, Labels: p.config.Labels})
+		}
+	}
+
+	return containers, nil
+}
+
+// logBuffer keeps everything written to it, and hands out readers that can
+// follow the writes until the buffer is closed.
+type logBuffer struct {
+	sync.Mutex
+	cond   *sync.Cond
+	data   []byte
+	closed bool
+}
+
+func newLogBuffer() *logBuffer {
+	b := &logBuffer{}
+	b.cond = sync.NewCond(b)
+	return b
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.data = append(b.data, p...)
+	b.cond.Broadcast()
+	return len(p), nil
+}
+
+func (b *logBuffer) Close() error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.closed = true
+	b.cond.Broadcast()
+	return nil
+}
+
+func (b *logBuffer) NewReader(follow bool) io.ReadCloser {
+	return &logBufferReader{buffer: b, follow: follow}
+}
+
+type logBufferReader struct {
+	buffer *logBuffer
+	offset int
+	follow bool
+	closed bool
+}
+
+func (r *logBufferReader) Read(p []byte) (int, error) {
+	b := r.buffer
+	b.Lock()
+	defer b.Unlock()
+
+	for r.follow && !b.closed && !r.closed && r.offset == len(b.data) {
+		b.cond.Wait()
+	}
+
+	if r.closed || r.offset == len(b.data) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, b.data[r.offset:])
+	r.offset += n
+	return n, nil
+}
+
+func (r *logBufferReader) Close() error {
+	b := r.buffer
+	b.Lock()
+	defer b.Unlock()
+
+	r.closed = true
+	b.cond.Broadcast()
+	return nil
+}
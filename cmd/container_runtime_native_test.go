@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestNativeRuntimeRunsCheckoutCommands(t *testing.T) {
+	checkout, err := ioutil.TempDir("", "kraken-lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(checkout)
+
+	if _, err := newNativeRuntime(checkout); err == nil {
+		t.Error("Expected a directory without ansible/inventory/localhost to be rejected")
+	}
+
+	os.MkdirAll(filepath.Join(checkout, "ansible", "inventory"), 0755)
+	os.MkdirAll(filepath.Join(checkout, "bin"), 0755)
+	ioutil.WriteFile(filepath.Join(checkout, "ansible", "inventory", "localhost"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(checkout, "bin", "tool.sh"), []byte("#!/bin/sh\necho \"$KRAKEN_TEST_ENV $@\"\nexit 3\n"), 0755)
+
+	rt, err := newNativeRuntime(checkout)
+	if err != nil {
+		t.Fatal("Expected checkout to be accepted, got", err)
+	}
+
+	ctx := getContext()
+	config := &container.Config{
+		Cmd: []string{"/kraken/bin/tool.sh", "get", "pods"},
+		Env: []string{"KRAKEN_TEST_ENV=from-config"},
+	}
+
+	resp, err := rt.ContainerCreate(ctx, config, &container.HostConfig{}, "krakenlibtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rt.ContainerCreate(ctx, config, &container.HostConfig{}, "krakenlibtest"); err == nil {
+		t.Error("Expected a second process with the same name to conflict")
+	}
+
+	if err := rt.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// inspecting while the process exits
+	for {
+		info, err := rt.ContainerInspect(ctx, resp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.State.Running {
+			break
+		}
+	}
+
+	statusCode, err := rt.ContainerWait(ctx, resp.ID)
+	if err != nil || statusCode != 3 {
+		t.Error("Expected exit status 3, got", statusCode, err)
+	}
+
+	if info, err := rt.ContainerInspect(ctx, resp.ID); err != nil || info.State.ExitCode != 3 {
+		t.Error("Expected the exit status to be inspected, got", info.State, err)
+	}
+
+	logs, err := rt.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{ShowStdout: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, _ := ioutil.ReadAll(logs)
+	expected := "from-config get pods"
+	if !strings.Contains(string(out), expected) {
+		t.Error("Expected output to contain", expected, "got", string(out))
+	}
+
+	if err := rt.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{}); err != nil {
+		t.Error("Expected exited process to be removed, got", err)
+	}
+}
+
+func TestNativeRuntimeBinds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kraken-binds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		bind string
+		ok   bool
+	}{
+		{dir + ":" + dir + ":ro", true},
+		{dir + ":" + link + ":ro", true},
+		{dir + ":/charts:ro", false},
+	}
+
+	for _, c := range cases {
+		err := checkNativeBinds(&container.HostConfig{Binds: []string{c.bind}})
+		if (err == nil) != c.ok {
+			t.Error("For", c.bind, "expected it to be accepted:", c.ok, "got", err)
+		}
+	}
+}
+
+func TestNativeRuntimeAttachesStdin(t *testing.T) {
+	checkout, err := ioutil.TempDir("", "kraken-lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(checkout)
+
+	os.MkdirAll(filepath.Join(checkout, "ansible", "inventory"), 0755)
+	ioutil.WriteFile(filepath.Join(checkout, "ansible", "inventory", "localhost"), nil, 0644)
+
+	rt, err := newNativeRuntime(checkout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := getContext()
+	resp, err := rt.ContainerCreate(ctx, &container.Config{Cmd: []string{"cat"}}, &container.HostConfig{}, "krakenlibcat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdio := &containerStdio{stdin: strings.NewReader("kind: Pod\n")}
+	var out bytes.Buffer
+	logs, err := stdio.attach(rt, resp, &out, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rt.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if statusCode, err := rt.ContainerWait(ctx, resp.ID); err != nil || statusCode != 0 {
+		t.Error("Expected cat to exit with 0, got", statusCode, err)
+	}
+
+	logs.wait(killWaitPeriod)
+	if out.String() != "kind: Pod\n" {
+		t.Errorf("Expected cat to echo its stdin, got %q", out.String())
+	}
+}
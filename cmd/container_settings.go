@@ -0,0 +1,93 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+)
+
+// cpuPeriod is the CFS scheduler period CPU limits are expressed in, 100ms like 'docker run --cpus'.
+const cpuPeriod int64 = 100000
+
+var containerMemory string
+var containerCPUs string
+var containerNetwork string
+var containerDNS []string
+var containerExtraHosts []string
+var ansibleForks int
+
+// applyContainerSettings sets the resource limits and network settings of kraken.config and
+// the command line on the host config of a kraken-lib container.
+func applyContainerSettings(hostConfig *container.HostConfig) error {
+	if memory := krakenConfig.GetString("container.memory"); memory != "" {
+		limit, err := units.RAMInBytes(memory)
+		if err != nil {
+			return fmt.Errorf("invalid container memory limit '%s': %v", memory, err)
+		}
+		hostConfig.Memory = limit
+	}
+
+	if cpus := krakenConfig.GetString("container.cpus"); cpus != "" {
+		limit, err := strconv.ParseFloat(cpus, 64)
+		if err != nil || limit <= 0 {
+			return fmt.Errorf("invalid container CPU limit '%s', use a positive number of CPUs such as 1.5", cpus)
+		}
+		hostConfig.CPUPeriod = cpuPeriod
+		hostConfig.CPUQuota = int64(limit * float64(cpuPeriod))
+	}
+
+	hostConfig.NetworkMode = container.NetworkMode(krakenConfig.GetString("container.network"))
+	hostConfig.DNS = krakenConfig.GetStringSlice("container.dns")
+	hostConfig.ExtraHosts = krakenConfig.GetStringSlice("container.extraHosts")
+
+	return nil
+}
+
+// describeContainerSettings lists the settings of hostConfig that differ from the defaults
+// of the container runtime.
+func describeContainerSettings(hostConfig *container.HostConfig) []string {
+	var settings []string
+	if hostConfig.Memory > 0 {
+		settings = append(settings, "memory "+units.BytesSize(float64(hostConfig.Memory)))
+	}
+	if hostConfig.CPUQuota > 0 {
+		settings = append(settings, fmt.Sprintf("cpus %g", float64(hostConfig.CPUQuota)/float64(hostConfig.CPUPeriod)))
+	}
+	if hostConfig.NetworkMode != "" {
+		settings = append(settings, "network "+string(hostConfig.NetworkMode))
+	}
+	if len(hostConfig.DNS) > 0 {
+		settings = append(settings, fmt.Sprintf("dns %v", hostConfig.DNS))
+	}
+	if len(hostConfig.ExtraHosts) > 0 {
+		settings = append(settings, fmt.Sprintf("extra hosts %v", hostConfig.ExtraHosts))
+	}
+
+	return settings
+}
+
+// withAnsibleForks passes the --forks setting on to ansible-playbook commands.
+func withAnsibleForks(command []string) []string {
+	forks := krakenConfig.GetInt("ansible.forks")
+	if forks <= 0 || len(command) == 0 || command[0] != "ansible-playbook" {
+		return command
+	}
+
+	return append(append([]string{}, command...), "--forks", strconv.Itoa(forks))
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestApplyContainerSettings(t *testing.T) {
+	defer func() {
+		krakenConfig.Set("container.memory", "")
+		krakenConfig.Set("container.cpus", "")
+		krakenConfig.Set("container.network", "")
+		krakenConfig.Set("container.dns", []string{})
+		krakenConfig.Set("container.extraHosts", []string{})
+	}()
+
+	hostConfig := &container.HostConfig{}
+	if err := applyContainerSettings(hostConfig); err != nil {
+		t.Fatal("Expected no error without settings, got", err)
+	}
+	if settings := describeContainerSettings(hostConfig); len(settings) != 0 {
+		t.Error("Expected the runtime defaults without settings, got", settings)
+	}
+
+	krakenConfig.Set("container.memory", "2g")
+	krakenConfig.Set("container.cpus", "1.5")
+	krakenConfig.Set("container.network", "host")
+	krakenConfig.Set("container.dns", []string{"10.0.0.2"})
+	krakenConfig.Set("container.extraHosts", []string{"registry.local:10.0.0.3"})
+
+	hostConfig = &container.HostConfig{}
+	if err := applyContainerSettings(hostConfig); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	if hostConfig.Memory != 2*1024*1024*1024 || hostConfig.CPUQuota != 150000 || hostConfig.CPUPeriod != cpuPeriod ||
+		hostConfig.NetworkMode != "host" || !reflect.DeepEqual(hostConfig.DNS, []string{"10.0.0.2"}) ||
+		!reflect.DeepEqual(hostConfig.ExtraHosts, []string{"registry.local:10.0.0.3"}) {
+		t.Errorf("Unexpected host config %+v", hostConfig)
+	}
+
+	expected := []string{"memory 2 GiB", "cpus 1.5", "network host", "dns [10.0.0.2]", "extra hosts [registry.local:10.0.0.3]"}
+	if settings := describeContainerSettings(hostConfig); !reflect.DeepEqual(settings, expected) {
+		t.Error("Expected", expected, "got", settings)
+	}
+
+	krakenConfig.Set("container.cpus", "many")
+	if err := applyContainerSettings(&container.HostConfig{}); err == nil {
+		t.Error("Expected an error for an invalid CPU limit")
+	}
+}
+
+func TestWithAnsibleForks(t *testing.T) {
+	defer krakenConfig.Set("ansible.forks", 0)
+
+	command := []string{"ansible-playbook", "ansible/up.yaml"}
+	if forked := withAnsibleForks(command); !reflect.DeepEqual(forked, command) {
+		t.Error("Expected the command unchanged without forks, got", forked)
+	}
+
+	krakenConfig.Set("ansible.forks", 5)
+	expected := []string{"ansible-playbook", "ansible/up.yaml", "--forks", "5"}
+	if forked := withAnsibleForks(command); !reflect.DeepEqual(forked, expected) {
+		t.Error("Expected", expected, "got", forked)
+	}
+
+	if forked := withAnsibleForks([]string{"kubectl", "get", "nodes"}); len(forked) != 3 {
+		t.Error("Expected only ansible-playbook commands to get forks, got", forked)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"golang.org/x/net/context"
+)
+
+// containerStdio connects a tool container to the terminal or the pipes kraken runs with:
+// its output is streamed while it runs, and stdin is forwarded to it.
+type containerStdio struct {
+	// stdin is forwarded to the container, if set
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	// terminal is set when the container gets a TTY. It is put in raw mode while the
+	// container runs, and its size is passed on to the container.
+	terminal *os.File
+}
+
+// newContainerStdio connects a tool container to the standard streams of kraken. It gets a
+// TTY when both stdin and stdout are terminals, and stdin when it is a terminal or piped.
+func newContainerStdio() *containerStdio {
+	stdio := &containerStdio{stdout: os.Stdout, stderr: os.Stderr}
+
+	switch {
+	case isTerminal(os.Stdin) && isTerminal(os.Stdout):
+		stdio.stdin = os.Stdin
+		// native processes write to a buffer, not to a TTY
+		if rawModeSupported && krakenConfig.GetString("exec-mode") != execModeNative {
+			stdio.terminal = os.Stdin
+		}
+	case isPiped(os.Stdin):
+		stdio.stdin = os.Stdin
+	}
+
+	return stdio
+}
+
+// isPiped reports whether f is fed by a pipe, a socket or a file.
+func isPiped(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&(os.ModeNamedPipe|os.ModeSocket) != 0 || info.Mode().IsRegular()
+}
+
+func (s *containerStdio) tty() bool {
+	return s.terminal != nil
+}
+
+// interactive reports whether s reads stdin from a terminal, that is from a user rather
+// than a pipe.
+func (s *containerStdio) interactive() bool {
+	f, ok := s.stdin.(*os.File)
+	return s.terminal != nil || ok && isTerminal(f)
+}
+
+// configure sets up config to attach to the container the way s connects it.
+func (s *containerStdio) configure(config *container.Config) {
+	config.AttachStdin = s.stdin != nil
+	config.OpenStdin = s.stdin != nil
+	config.StdinOnce = s.stdin != nil
+	config.Tty = s.tty()
+}
+
+// attach connects to the container before it starts, so nothing it writes or reads is
+// lost, and copies its output to stdout and stderr until it exits.
+func (s *containerStdio) attach(rt ContainerRuntime, resp types.ContainerCreateResponse, stdout io.Writer, stderr io.Writer) (*logStream, error) {
+	options := types.ContainerAttachOptions{Stream: true, Stdin: s.stdin != nil, Stdout: true, Stderr: true}
+	hijacked, err := rt.ContainerAttach(getContext(), resp.ID, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.stdin != nil {
+		go func() {
+			io.Copy(hijacked.Conn, s.stdin)
+			// the container sees the end of its stdin, e.g. for 'kubectl apply -f -'
+			hijacked.CloseWrite()
+		}()
+	}
+
+	stream := &logStream{reader: hijackedReader{hijacked}, done: make(chan struct{})}
+	go func() {
+		defer close(stream.done)
+		if s.tty() {
+			// TTY output is not multiplexed, and prompts must show before a full frame header
+			_, stream.err = io.Copy(stdout, hijacked.Reader)
+		} else {
+			stream.err = demuxLogs(hijacked.Reader, stdout, stderr)
+		}
+	}()
+
+	return stream, nil
+}
+
+// start puts the terminal in raw mode and keeps the size of the TTY of the started
+// container in line with it, until the returned function is called.
+func (s *containerStdio) start(rt ContainerRuntime, resp types.ContainerCreateResponse) func() {
+	if !s.tty() {
+		return func() {}
+	}
+
+	restore, err := makeRaw(s.terminal)
+	if err != nil {
+		fmt.Fprintf(s.stderr, "Could not put the terminal in raw mode: %s \n", err)
+		restore = func() {}
+	}
+
+	resize := func() {
+		if height, width, err := terminalSize(s.terminal); err == nil {
+			rt.ContainerResize(getContext(), resp.ID, types.ResizeOptions{Height: height, Width: width})
+		}
+	}
+	resize()
+
+	done := make(chan struct{})
+	if len(resizeSignals) > 0 {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, resizeSignals...)
+		go func() {
+			defer signal.Stop(signals)
+			for {
+				select {
+				case <-signals:
+					resize()
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	return func() {
+		close(done)
+		restore()
+	}
+}
+
+// hijackedReader reads the output of an attached container, closing the connection.
+type hijackedReader struct {
+	hijacked types.HijackedResponse
+}
+
+func (r hijackedReader) Read(p []byte) (int, error) {
+	return r.hijacked.Reader.Read(p)
+}
+
+func (r hijackedReader) Close() error {
+	r.hijacked.Close()
+	return nil
+}
+
+// streamConn is a net.Conn over the output and the stdin of a process, standing in for
+// the hijacked connection of a container attach in runtimes without one.
+type streamConn struct {
+	io.Reader
+	stdin io.WriteCloser
+}
+
+func (c *streamConn) Write(p []byte) (int, error) {
+	if c.stdin == nil {
+		return 0, fmt.Errorf("stdin is not attached")
+	}
+
+	return c.stdin.Write(p)
+}
+
+// CloseWrite closes stdin, leaving the output open.
+func (c *streamConn) CloseWrite() error {
+	if c.stdin == nil {
+		return nil
+	}
+
+	return c.stdin.Close()
+}
+
+func (c *streamConn) Close() error {
+	c.CloseWrite()
+	if closer, ok := c.Reader.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func (c *streamConn) LocalAddr() net.Addr                { return streamAddr{} }
+func (c *streamConn) RemoteAddr() net.Addr               { return streamAddr{} }
+func (c *streamConn) SetDeadline(t time.Time) error      { return nil }
+func (c *streamConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *streamConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type streamAddr struct{}
+
+func (streamAddr) Network() string { return "stream" }
+func (streamAddr) String() string  { return "stream" }
+
+// runToolCommand runs command for a tool action in a container connected to the terminal
+// or pipes of kraken, and returns its exit code.
+func runToolCommand(rt ContainerRuntime, action string, command []string) (int, error) {
+	stdio := newContainerStdio()
+	ctx, cancel := toolContext(action, stdio)
+	defer cancel()
+
+	_, statusCode, cleanup, err := containerAction(ctx, rt, action, command, ClusterConfigPath, ioutil.Discard, nil, stdio)
+	if cleanup != nil {
+		defer cleanup()
+	}
+
+	if err != nil {
+		switch err.(type) {
+		case *interruptedError, *timeoutError:
+			return statusCode, err
+		}
+		return 1, err
+	}
+
+	return statusCode, nil
+}
+
+// toolContext is the context of a tool command. Sessions reading a terminal, such as a
+// shell or 'logs -f', last as long as the user wants: they only get a timeout the user
+// set. Others, piped input included, get the timeout of the action.
+func toolContext(action string, stdio *containerStdio) (context.Context, context.CancelFunc) {
+	if !stdio.interactive() {
+		return getTimedContext(action)
+	}
+
+	if timeout, ok := configuredActionTimeout(action); ok {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+
+	return context.WithCancel(context.Background())
+}
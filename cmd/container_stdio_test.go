@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestContainerActionWithStdio(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.Run = func(config *container.Config) (string, int) {
+		return "pod/test created\n", 0
+	}
+	defer useFakeRuntime(rt)()
+
+	var terminal bytes.Buffer
+	stdio := &containerStdio{stdin: strings.NewReader("kind: Pod\n"), stdout: &terminal, stderr: &terminal}
+
+	var out bytes.Buffer
+	resp, statusCode, cleanup, err := containerAction(getContext(), rt, actionKubectl, []string{"kubectl", "apply", "-f", "-"}, "", &out, nil, stdio)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	cleanup()
+
+	if statusCode != 0 {
+		t.Error("Expected exit code 0, got", statusCode)
+	}
+
+	if terminal.String() != "pod/test created\n" || out.String() != terminal.String() {
+		t.Errorf("Expected the output to stream to the terminal and out, got %q and %q", terminal.String(), out.String())
+	}
+
+	c := rt.Containers[resp.ID]
+	if c.Stdin != "kind: Pod\n" {
+		t.Errorf("Expected stdin to be forwarded, got %q", c.Stdin)
+	}
+
+	if !c.Config.OpenStdin || !c.Config.StdinOnce || c.Config.Tty {
+		t.Errorf("Expected an open stdin without TTY, got %+v", c.Config)
+	}
+}
+
+func TestContainerStdioConfigure(t *testing.T) {
+	config := &container.Config{}
+	(&containerStdio{}).configure(config)
+	if config.AttachStdin || config.OpenStdin || config.Tty {
+		t.Errorf("Expected no stdin and no TTY, got %+v", config)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// users the kraken-lib container can run as, besides an explicit <uid>[:<gid>]
+const (
+	// containerUserRoot runs the container as root, and gives the files it leaves as root
+	// in the output folder to the host user afterwards
+	containerUserRoot string = "root"
+	// containerUserHost runs the container as the host user
+	containerUserHost string = "host"
+)
+
+var containerUserRegex = regexp.MustCompile(`^[0-9]+(:[0-9]+)?$`)
+
+// hostUID and hostGID identify the invoking user, tests replace them.
+var hostUID = os.Getuid
+var hostGID = os.Getgid
+
+// hostOwner is the uid:gid of the invoking user, and whether the files kraken-lib writes
+// can end up owned by someone else. They cannot when kraken runs as root, on Windows,
+// natively, or with a rootless engine, which maps container root to the invoking user.
+func hostOwner() (string, bool) {
+	uid := hostUID()
+	if uid <= 0 || dockerClient.Rootless || krakenConfig.GetString("exec-mode") == execModeNative {
+		return "", false
+	}
+
+	return fmt.Sprintf("%d:%d", uid, hostGID()), true
+}
+
+// containerUser is the user the kraken-lib container runs as, set with --container-user or
+// 'container.user' in kraken.config, and the host user to give the files it leaves in the
+// output folder to once it is done, if any.
+func containerUser() (string, string, error) {
+	owner, ok := hostOwner()
+
+	switch user := krakenConfig.GetString("container.user"); user {
+	case "", containerUserRoot:
+		if !ok {
+			return "0", "", nil
+		}
+		return "0", owner, nil
+	case containerUserHost:
+		return owner, "", nil
+	default:
+		if !containerUserRegex.MatchString(user) {
+			return "", "", fmt.Errorf("unsupported container user '%s', use one of: %s, %s, <uid>[:<gid>]", user, containerUserRoot, containerUserHost)
+		}
+		return user, "", nil
+	}
+}
+
+// containerUserEnvironment is the environment of a container running as user. Users
+// other than root get a writable HOME, as they have none in the image.
+func containerUserEnvironment(user string) []string {
+	if user == "" || user == "0" || user == "0:0" {
+		return nil
+	}
+
+	return []string{"HOME=/tmp"}
+}
+
+// writesOutput reports whether action leaves files in the output folder.
+func writesOutput(action string) bool {
+	switch action {
+	case actionUp, actionDown, actionUpdate, actionSSHRefresh, actionGenerate:
+		return true
+	}
+
+	return false
+}
+
+// actionOutputPath is where action writes on the host: the generated config file for
+// generate, the folder of the cluster in the output folder otherwise.
+func actionOutputPath(action string) string {
+	if action == actionGenerate {
+		return generatePath
+	}
+
+	return path.Join(outputLocation, getFirstClusterName())
+}
+
+// giveActionOutputToHost gives the files action left owned by root to the host user, if
+// kraken-lib ran as root for one. It runs once a command is done, whatever its attempts.
+func giveActionOutputToHost(action string) {
+	if !writesOutput(action) {
+		return
+	}
+
+	outputPath := actionOutputPath(action)
+	if _, err := os.Stat(outputPath); err != nil {
+		return
+	}
+
+	rt, err := newContainerRuntime()
+	if err != nil {
+		return
+	}
+
+	_, owner, err := containerUser()
+	if err != nil || owner == "" {
+		return
+	}
+
+	// nothing ran if the image could not be pulled
+	if _, err := rt.ImageInspect(getContext(), containerImage); err != nil {
+		return
+	}
+
+	if err := giveOutputToHost(rt, outputPath, owner); err != nil {
+		fmt.Printf("Could not give the files kraken-lib wrote in %s to user %s: %s \n", outputPath, owner, err)
+	}
+}
+
+// giveOutputToHost runs a container giving the files left owned by root in outputPath to
+// owner, the host user.
+func giveOutputToHost(rt ContainerRuntime, outputPath string, owner string) error {
+	ctx := getContext()
+
+	containerConfig := &container.Config{
+		Image:        containerImage,
+		User:         "0",
+		Cmd:          []string{"find", outputPath, "-uid", "0", "-exec", "chown", "-h", owner, "{}", "+"},
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+	hostConfig := &container.HostConfig{Binds: []string{outputPath + ":" + outputPath}}
+
+	resp, err := rt.ContainerCreate(ctx, containerConfig, hostConfig, "")
+	if err != nil {
+		return err
+	}
+
+	defer rt.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{Force: true})
+
+	if err := rt.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return err
+	}
+
+	statusCode, err := rt.ContainerWait(ctx, resp.ID)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != 0 {
+		out, _ := printContainerLogs(ctx, rt, resp)
+		return fmt.Errorf("chown exited with %d: %s", statusCode, out)
+	}
+
+	return nil
+}
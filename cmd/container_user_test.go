@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestContainerUser(t *testing.T) {
+	rt := newFakeRuntime()
+	defer useFakeRuntime(rt)()
+
+	originalGID := hostGID
+	defer func() { hostGID = originalGID }()
+
+	hostUID = func() int { return 1000 }
+	hostGID = func() int { return 100 }
+	defer krakenConfig.Set("container.user", containerUserRoot)
+
+	cases := []struct {
+		setting string
+		user    string
+		owner   string
+	}{
+		{containerUserRoot, "0", "1000:100"},
+		{containerUserHost, "1000:100", ""},
+		{"1001:1001", "1001:1001", ""},
+	}
+
+	for _, c := range cases {
+		krakenConfig.Set("container.user", c.setting)
+		user, owner, err := containerUser()
+		if err != nil || user != c.user || owner != c.owner {
+			t.Error("For", c.setting, "expected user", c.user, "and owner", c.owner, "got", user, owner, err)
+		}
+	}
+
+	krakenConfig.Set("container.user", "nobody")
+	if _, _, err := containerUser(); err == nil {
+		t.Error("Expected a user name to be refused")
+	}
+
+	if env := containerUserEnvironment("1000:100"); len(env) != 1 || env[0] != "HOME=/tmp" {
+		t.Error("Expected a writable HOME for a host user, got", env)
+	}
+
+	if err := giveOutputToHost(rt, outputLocation, "1000:100"); err != nil {
+		t.Fatal("Expected the output to be given to the host user, got", err)
+	}
+
+	for _, c := range rt.Containers {
+		if c.Config.User != "0" || strings.Join(c.Config.Cmd, " ") != "find "+outputLocation+" -uid 0 -exec chown -h 1000:100 {} +" || !c.Removed {
+			t.Errorf("Unexpected ownership container %+v", c.Config)
+		}
+	}
+}
+
+func TestContainerUserWithPodman(t *testing.T) {
+	rt := newFakeRuntime()
+	defer useFakeRuntime(rt)()
+
+	originalGID := hostGID
+	defer func() { hostGID = originalGID }()
+	defer func(original DockerClientConfig) { dockerClient = original }(dockerClient)
+
+	hostUID = func() int { return 1000 }
+	hostGID = func() int { return 100 }
+	krakenConfig.Set("container.user", containerUserRoot)
+	dockerClient.Runtime = runtimePodman
+
+	cases := []struct {
+		rootless bool
+		owner    string
+	}{
+		// rootful podman runs containers as the real root, like docker
+		{false, "1000:100"},
+		// rootless podman maps container root to the invoking user
+		{true, ""},
+	}
+
+	for _, c := range cases {
+		dockerClient.Rootless = c.rootless
+		user, owner, err := containerUser()
+		if err != nil || user != "0" || owner != c.owner {
+			t.Error("For rootless", c.rootless, "expected owner", c.owner, "got", user, owner, err)
+		}
+	}
+}
+
+func TestGiveActionOutputToHost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kraken-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer useOutputLocation(dir)()
+
+	rt := newFakeRuntime()
+	defer useFakeRuntime(rt)()
+
+	originalGID := hostGID
+	defer func() { hostGID = originalGID }()
+
+	hostUID = func() int { return 1000 }
+	hostGID = func() int { return 100 }
+	krakenConfig.Set("container.user", containerUserRoot)
+	rt.Images[containerImage] = types.ImageInspect{ID: "sha256:kraken-lib"}
+
+	clusterDir := path.Join(dir, getFirstClusterName())
+	if err := os.MkdirAll(clusterDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// tools leave nothing in the output folder
+	giveActionOutputToHost(actionHelm)
+	if len(rt.Containers) != 0 {
+		t.Fatal("Expected no ownership container for helm, got", len(rt.Containers))
+	}
+
+	giveActionOutputToHost(actionUp)
+	if len(rt.Containers) != 1 {
+		t.Fatal("Expected one ownership container for up, got", len(rt.Containers))
+	}
+
+	for _, c := range rt.Containers {
+		if strings.Join(c.Config.Cmd, " ") != "find "+clusterDir+" -uid 0 -exec chown -h 1000:100 {} +" {
+			t.Error("Expected only the folder of the cluster to be given to the host user, got", c.Config.Cmd)
+		}
+		if len(c.HostConfig.Binds) != 1 || c.HostConfig.Binds[0] != clusterDir+":"+clusterDir {
+			t.Error("Expected only the folder of the cluster to be mounted, got", c.HostConfig.Binds)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"crypto/tls"
 	"path/filepath"
@@ -14,6 +16,14 @@ import (
 // DockerAPIVersion defines the docker api version used.
 var DockerAPIVersion = client.DefaultVersion
 
+const (
+	runtimeDocker string = "docker"
+	runtimePodman string = "podman"
+)
+
+// defaultDockerSocket is the socket probed first when auto-detecting the container runtime.
+var defaultDockerSocket = strings.TrimPrefix(client.DefaultDockerHost, "unix://")
+
 // DockerClientConfig provides a simple encapsulation of parameters to construct the Docker API client
 type DockerClientConfig struct {
 	DockerHost       string
@@ -23,6 +33,11 @@ type DockerClientConfig struct {
 	TLSCACertificate string
 	TLSCertificate   string
 	TLSKey           string
+
+	// Runtime is the engine behind DockerHost: docker, podman or empty to auto-detect.
+	Runtime string
+	// Rootless is set when the engine runs containers in a user namespace owned by the invoking user.
+	Rootless bool
 }
 
 // GetDefaultHost produces either the environment-provided host, or a sensible default.
@@ -101,6 +116,74 @@ func (conf *DockerClientConfig) isInheritedFromEnvironment() bool {
 
 }
 
+// podmanSocketPaths lists the Docker-compatible podman API sockets, rootless first.
+func podmanSocketPaths() []string {
+	var paths []string
+
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		paths = append(paths, filepath.Join(runtimeDir, "podman", "podman.sock"))
+	}
+
+	return append(paths, "/run/podman/podman.sock")
+}
+
+func socketExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
+
+// resolveRuntime settles which engine and socket to use. An explicitly configured host
+// (flag or DOCKER_HOST) always wins, otherwise the docker socket is probed first, then podman's.
+func (conf *DockerClientConfig) resolveRuntime() error {
+	switch conf.Runtime {
+	case "", runtimeDocker, runtimePodman:
+	default:
+		return fmt.Errorf("unsupported container runtime '%s', use one of: %s, %s", conf.Runtime, runtimeDocker, runtimePodman)
+	}
+
+	if conf.DockerHost != client.DefaultDockerHost || os.Getenv("DOCKER_HOST") != "" {
+		if conf.Runtime == "" {
+			conf.Runtime = runtimeDocker
+			if strings.Contains(conf.DockerHost, "podman") {
+				conf.Runtime = runtimePodman
+			}
+		}
+		conf.Rootless = isUserSocket(conf.DockerHost)
+		return nil
+	}
+
+	if conf.Runtime != runtimePodman && socketExists(defaultDockerSocket) {
+		conf.Runtime = runtimeDocker
+		return nil
+	}
+
+	if conf.Runtime != runtimeDocker {
+		for _, socket := range podmanSocketPaths() {
+			if socketExists(socket) {
+				conf.Runtime = runtimePodman
+				conf.DockerHost = "unix://" + socket
+				conf.Rootless = isUserSocket(conf.DockerHost)
+				return nil
+			}
+		}
+	}
+
+	if conf.Runtime == runtimePodman {
+		return fmt.Errorf("no podman socket found at %s, start one with 'systemctl --user start podman.socket'", strings.Join(podmanSocketPaths(), " or "))
+	}
+
+	// nothing answered, leave the docker default so the client reports the connection error
+	conf.Runtime = runtimeDocker
+	return nil
+}
+
+// isUserSocket reports whether host is a socket in the invoking user's runtime directory,
+// which is where a rootless podman or docker service listens.
+func isUserSocket(host string) bool {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	return runtimeDir != "" && strings.HasPrefix(strings.TrimPrefix(host, "unix://"), runtimeDir)
+}
+
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return os.IsExist(err)
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/client"
+)
+
+func listenUnix(t *testing.T, path string) net.Listener {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
+
+func TestResolveRuntimeFindsRootlessPodman(t *testing.T) {
+	runtimeDir, err := ioutil.TempDir("", "kraken-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(runtimeDir)
+
+	originalRuntimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	originalDockerHost := os.Getenv("DOCKER_HOST")
+	originalDockerSocket := defaultDockerSocket
+	defer func() {
+		os.Setenv("XDG_RUNTIME_DIR", originalRuntimeDir)
+		os.Setenv("DOCKER_HOST", originalDockerHost)
+		defaultDockerSocket = originalDockerSocket
+	}()
+
+	os.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	os.Setenv("DOCKER_HOST", "")
+	defaultDockerSocket = filepath.Join(runtimeDir, "docker.sock")
+
+	podmanSocket := filepath.Join(runtimeDir, "podman", "podman.sock")
+	l := listenUnix(t, podmanSocket)
+	defer l.Close()
+
+	conf := DockerClientConfig{DockerHost: client.DefaultDockerHost}
+	if err := conf.resolveRuntime(); err != nil {
+		t.Fatal("Expected podman to be detected, got", err)
+	}
+
+	if conf.Runtime != runtimePodman || conf.DockerHost != "unix://"+podmanSocket || !conf.Rootless {
+		t.Error("Expected rootless podman at", podmanSocket, "got", conf.Runtime, conf.DockerHost, conf.Rootless)
+	}
+
+	// the docker socket is preferred when both are present
+	d := listenUnix(t, defaultDockerSocket)
+	defer d.Close()
+
+	conf = DockerClientConfig{DockerHost: client.DefaultDockerHost}
+	if err := conf.resolveRuntime(); err != nil || conf.Runtime != runtimeDocker || conf.DockerHost != client.DefaultDockerHost {
+		t.Error("Expected docker to be preferred, got", conf.Runtime, conf.DockerHost, err)
+	}
+
+	// unless podman was asked for
+	conf = DockerClientConfig{DockerHost: client.DefaultDockerHost, Runtime: runtimePodman}
+	if err := conf.resolveRuntime(); err != nil || conf.DockerHost != "unix://"+podmanSocket {
+		t.Error("Expected podman socket when requested, got", conf.DockerHost, err)
+	}
+
+	conf = DockerClientConfig{DockerHost: client.DefaultDockerHost, Runtime: "rkt"}
+	if err := conf.resolveRuntime(); err == nil {
+		t.Error("Expected an error for an unsupported runtime")
+	}
+}
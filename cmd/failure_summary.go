@@ -0,0 +1,121 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// lines of output shown when no failed task is known
+const failureTailLines = 20
+
+// lines of a failed task's stderr shown in the summary
+const failureStderrLines = 10
+
+// ansibleFailure is the last task failure of an action, from its ansible events.
+type ansibleFailure struct {
+	Play   string
+	Role   string
+	Task   string
+	Host   string
+	Msg    string
+	Stderr string
+	// Stage is the stage the progress of the action showed when the task failed
+	Stage string
+}
+
+// retryCommand is the command line kraken was run with, to run stage and the stages it depends on.
+func retryCommand(stage string) string {
+	args := []string{filepath.Base(os.Args[0])}
+
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch {
+		case arg == "--tags" || arg == "--stages" || arg == "-s":
+			i++
+		case strings.HasPrefix(arg, "--tags=") || strings.HasPrefix(arg, "--stages=") || strings.HasPrefix(arg, "-s="):
+		default:
+			args = append(args, arg)
+		}
+	}
+
+	return strings.Join(append(args, "--tags", stage), " ")
+}
+
+// printFailureSummary prints the failed task of the kraken-lib action being run, or the
+// end of its output when none is known, how to retry its stage, and where to find the
+// full log.
+func printFailureSummary(action string, out []byte) {
+	var failure *ansibleFailure
+	if currentRun != nil {
+		failure = currentRun.failure
+	}
+
+	if failure != nil {
+		fmt.Println("Failed task:")
+		if failure.Play != "" {
+			fmt.Printf("  Play:   %s \n", failure.Play)
+		}
+		if failure.Role != "" {
+			fmt.Printf("  Task:   %s : %s \n", failure.Role, failure.Task)
+		} else {
+			fmt.Printf("  Task:   %s \n", failure.Task)
+		}
+		fmt.Printf("  Host:   %s \n", failure.Host)
+		if failure.Stage != "" {
+			fmt.Printf("  Stage:  %s \n", failure.Stage)
+		}
+		if failure.Msg != "" {
+			fmt.Printf("  Error:  %s \n", failure.Msg)
+		}
+		if failure.Stderr != "" {
+			fmt.Println("  Stderr:")
+			fmt.Println(indent(tail(failure.Stderr, failureStderrLines), "    "))
+		}
+	} else {
+		fmt.Println("Last lines of output:")
+		fmt.Println(indent(tail(string(out), failureTailLines), "  "))
+	}
+
+	logFilePath := strings.TrimSpace(logPath)
+	if currentRun != nil {
+		logFilePath = currentRun.LogFile
+	}
+
+	if logFilePath != "" {
+		fmt.Printf("Full log: %s \n", logFilePath)
+	}
+
+	if failure != nil && failure.Stage != "" && (action == actionUp || action == actionDown) {
+		fmt.Printf("To retry stage '%s' and the stages it depends on, run: \n  %s \n", failure.Stage, retryCommand(failure.Stage))
+	}
+}
+
+// tail returns the last n lines of s.
+func tail(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\r\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func indent(s string, prefix string) string {
+	return prefix + strings.Replace(s, "\n", "\n"+prefix, -1)
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestStageProgressFailure(t *testing.T) {
+	var out bytes.Buffer
+	progress := newStageProgress("", &out, false)
+
+	events := []ansibleEvent{
+		{Event: "task_start", Play: "Bring up cluster", Role: "kraken.config", Task: "kraken.config : Load config"},
+		{Event: "result", Play: "Bring up cluster", Task: "kraken.config : Load config", Host: "localhost", Status: "ok"},
+		{Event: "task_start", Play: "Bring up cluster", Role: "kraken.provider/kraken.provider.aws", Task: "kraken.provider/kraken.provider.aws : Check quota"},
+		{Event: "result", Play: "Bring up cluster", Task: "kraken.provider/kraken.provider.aws : Check quota", Host: "localhost", Status: "ignored", Msg: "quota check failed"},
+	}
+	for _, e := range events {
+		progress.handle(e)
+	}
+
+	// ignored failures are not failures
+	if failure := progress.Failure(); failure != nil {
+		t.Error("Expected an ignored failure not to be reported, got", failure)
+	}
+
+	// a task of no role of its own takes its stage from its tags, as the progress does
+	progress.handle(ansibleEvent{Event: "task_start", Play: "Bring up cluster", Task: "Create VPC", Tags: []string{"provider"}})
+	progress.handle(ansibleEvent{Event: "task_start", Play: "Wait for cluster", Task: "Wait for nodes", Tags: []string{"readiness"}})
+	progress.handle(ansibleEvent{Event: "result", Play: "Wait for cluster", Task: "Wait for nodes", Host: "node-1", Status: "unreachable", Msg: "Connection timed out", Stderr: "ssh: timeout"})
+
+	expected := ansibleFailure{
+		Play:   "Wait for cluster",
+		Task:   "Wait for nodes",
+		Host:   "node-1",
+		Msg:    "Connection timed out",
+		Stderr: "ssh: timeout",
+		Stage:  "readiness",
+	}
+	failure := progress.Failure()
+	if failure == nil || *failure != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, failure)
+	}
+
+	if progress.stage != failure.Stage {
+		t.Error("Expected the failure in the stage shown by the progress", progress.stage, "got", failure.Stage)
+	}
+
+	progress.handle(ansibleEvent{Event: "task_start", Play: "Bring up cluster", Role: "kraken.provider/kraken.provider.aws", Task: "kraken.provider/kraken.provider.aws : Create VPC"})
+	progress.handle(ansibleEvent{Event: "result", Play: "Bring up cluster", Task: "kraken.provider/kraken.provider.aws : Create VPC", Host: "localhost", Status: "failed", Msg: "non-zero return code"})
+	if failure := progress.Failure(); failure.Role != "kraken.provider/kraken.provider.aws" || failure.Task != "Create VPC" || failure.Stage != "provider" {
+		t.Errorf("Expected the last failure with its role, got %+v", failure)
+	}
+}
+
+func TestRetryCommand(t *testing.T) {
+	originalArgs := os.Args
+	defer func() { os.Args = originalArgs }()
+
+	os.Args = []string{"/usr/local/bin/kraken", "cluster", "up", "--config", "/tmp/config.yaml", "--tags", "all", "-s=all"}
+	if command := retryCommand("provider"); command != "kraken cluster up --config /tmp/config.yaml --tags provider" {
+		t.Error("Unexpected retry command", command)
+	}
+
+	os.Args = []string{"kraken", "cluster", "down", "--tags=services", "-v"}
+	if command := retryCommand("readiness"); command != "kraken cluster down -v --tags readiness" {
+		t.Error("Unexpected retry command", command)
+	}
+}
@@ -87,7 +87,7 @@ func runFunc(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	ExitCode, err = runKrakenLibCommand(spinnerPrefix, command, "", onFailure, onSuccess)
+	ExitCode, err = runKrakenLibCommand(actionGenerate, spinnerPrefix, command, "", onFailure, onSuccess)
 	return err
 }
 
@@ -0,0 +1,166 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// imageDigestFile holds the kraken-lib image a cluster was created with, by digest.
+const imageDigestFile string = "image-digest"
+
+var allowImageChange bool
+
+func imageDigestPath(clusterName string) string {
+	return filepath.Join(outputLocation, clusterName, imageDigestFile)
+}
+
+// readImageDigest returns the image pinned for the cluster, or "" when none is.
+func readImageDigest(clusterName string) (string, error) {
+	data, err := ioutil.ReadFile(imageDigestPath(clusterName))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	return strings.TrimSpace(string(data)), err
+}
+
+func writeImageDigest(clusterName string, digest string) error {
+	if err := os.MkdirAll(filepath.Dir(imageDigestPath(clusterName)), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(imageDigestPath(clusterName), []byte(digest+"\n"), 0644)
+}
+
+// imageRepository strips the tag or digest from an image reference.
+func imageRepository(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		return ref[:i]
+	}
+
+	// a colon before the last slash belongs to the registry host's port
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i]
+	}
+
+	return ref
+}
+
+// isRepoDigest reports whether ref is a repository@digest reference, which can be pulled.
+func isRepoDigest(ref string) bool {
+	return strings.Contains(ref, "@")
+}
+
+// imageDigest resolves ref to the repository@digest reference of the local image. Images
+// without a digest from the repository of ref, such as locally built ones, are identified
+// by their ID instead.
+func imageDigest(ctx context.Context, rt ContainerRuntime, ref string) (string, error) {
+	image, err := rt.ImageInspect(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+
+	repository := imageRepository(ref)
+	for _, digest := range image.RepoDigests {
+		if imageRepository(digest) == repository {
+			return digest, nil
+		}
+	}
+
+	return image.ID, nil
+}
+
+// pinsImage reports whether action runs against the image pinned for the cluster.
+func pinsImage(action string) bool {
+	if krakenConfig.GetString("exec-mode") == execModeNative {
+		return false
+	}
+
+	return action == actionUp || action == actionUpdate || action == actionDown
+}
+
+// useClusterImage runs the image pinned for the cluster, unless another one was asked for
+// with --image, which then has to match the pin (see verifyClusterImage).
+func useClusterImage(action string) error {
+	if !pinsImage(action) || RootCmd.PersistentFlags().Changed("image") {
+		return nil
+	}
+
+	pinned, err := readImageDigest(getFirstClusterName())
+	if err != nil {
+		return err
+	}
+
+	// a local image pinned by ID, as older versions did, cannot be pulled: it is only verified
+	if isRepoDigest(pinned) {
+		containerImage = pinned
+	}
+
+	return nil
+}
+
+// verifyClusterImage resolves the digest of the image about to run and refuses it when it
+// differs from the one pinned for the cluster, unless --allow-image-change is set.
+func verifyClusterImage(ctx context.Context, rt ContainerRuntime, action string) (string, error) {
+	if !pinsImage(action) {
+		return "", nil
+	}
+
+	digest, err := imageDigest(ctx, rt, containerImage)
+	if err != nil {
+		return "", err
+	}
+
+	clusterName := getFirstClusterName()
+	pinned, err := readImageDigest(clusterName)
+	if err != nil {
+		return "", err
+	}
+
+	if pinned != "" && pinned != digest && !allowImageChange {
+		return "", fmt.Errorf("cluster %s was created with kraken-lib image %s, but %s is %s. "+
+			"Pass --allow-image-change to run it anyway", clusterName, pinned, containerImage, digest)
+	}
+
+	return digest, nil
+}
+
+// recordClusterImage pins digest for the cluster after its first successful up, or after
+// a successful up or update allowed to change the image. Only images from a registry are
+// pinned, the ID of a locally built image could not be pulled by later runs.
+func recordClusterImage(action string, digest string) error {
+	if !isRepoDigest(digest) || (action != actionUp && action != actionUpdate) {
+		return nil
+	}
+
+	clusterName := getFirstClusterName()
+	pinned, err := readImageDigest(clusterName)
+	if err != nil {
+		return err
+	}
+
+	if pinned == digest || (pinned == "" && action != actionUp) || (pinned != "" && !allowImageChange) {
+		return nil
+	}
+
+	return writeImageDigest(clusterName, digest)
+}
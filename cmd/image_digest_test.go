@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestImageRepository(t *testing.T) {
+	cases := map[string]string{
+		"quay.io/samsung_cnct/kraken-lib:latest":           "quay.io/samsung_cnct/kraken-lib",
+		"quay.io/samsung_cnct/kraken-lib@sha256:0123":      "quay.io/samsung_cnct/kraken-lib",
+		"registry:5000/kraken-lib":                         "registry:5000/kraken-lib",
+		"registry:5000/kraken-lib:v1.2":                    "registry:5000/kraken-lib",
+		"kraken-lib":                                       "kraken-lib",
+		"registry:5000/kraken-lib:v1.2@sha256:0123456789a": "registry:5000/kraken-lib:v1.2",
+	}
+
+	for ref, expected := range cases {
+		if repository := imageRepository(ref); repository != expected {
+			t.Error("For", ref, "expected repository", expected, "got", repository)
+		}
+	}
+}
+
+func TestClusterImagePinning(t *testing.T) {
+	output, err := ioutil.TempDir("", "kraken-digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+
+	defer useOutputLocation(output)()
+
+	originalImage := containerImage
+	defer func() {
+		containerImage = originalImage
+		allowImageChange = false
+		RootCmd.PersistentFlags().Lookup("image").Changed = false
+	}()
+
+	krakenConfig.Set("container.pull", pullMissing)
+	defer krakenConfig.Set("container.pull", pullAlways)
+
+	repository := imageRepository(containerImage)
+	rt := newFakeRuntime()
+	rt.Images[containerImage] = types.ImageInspect{ID: "sha256:aaa", RepoDigests: []string{repository + "@sha256:aaa"}}
+	rt.Images[repository+"@sha256:aaa"] = rt.Images[containerImage]
+	defer useFakeRuntime(rt)()
+
+	run := func(action string) (int, error) {
+		return runKrakenLibCommand(action, "testing ", []string{"true"}, "", func([]byte) {}, func([]byte) {})
+	}
+
+	if _, err := run(actionUp); err != nil {
+		t.Fatal("Expected up to succeed, got", err)
+	}
+
+	pinned, err := readImageDigest(getFirstClusterName())
+	if err != nil || pinned != repository+"@sha256:aaa" {
+		t.Fatal("Expected up to pin the image digest, got", pinned, err)
+	}
+
+	// the tag moves on, later runs keep using the pinned image
+	rt.Images[originalImage] = types.ImageInspect{ID: "sha256:bbb", RepoDigests: []string{repository + "@sha256:bbb"}}
+	rt.Containers = map[string]*fakeContainer{}
+	if _, err := run(actionUpdate); err != nil {
+		t.Fatal("Expected update with the pinned image to succeed, got", err)
+	}
+	for _, c := range rt.Containers {
+		if c.Config.Image != pinned {
+			t.Error("Expected the pinned image", pinned, "to run, got", c.Config.Image)
+		}
+	}
+
+	containerImage = originalImage
+	RootCmd.PersistentFlags().Lookup("image").Changed = true
+	if _, err := run(actionDown); err == nil || !strings.Contains(err.Error(), "--allow-image-change") {
+		t.Error("Expected a different image to be refused, got", err)
+	}
+
+	allowImageChange = true
+	if _, err := run(actionUpdate); err != nil {
+		t.Fatal("Expected --allow-image-change to run the new image, got", err)
+	}
+
+	if pinned, _ := readImageDigest(getFirstClusterName()); pinned != repository+"@sha256:bbb" {
+		t.Error("Expected the new image to be pinned after a successful update, got", pinned)
+	}
+}
+
+func TestLocalImageIsNotPinned(t *testing.T) {
+	output, err := ioutil.TempDir("", "kraken-digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+
+	defer useOutputLocation(output)()
+
+	originalImage := containerImage
+	defer func() { containerImage = originalImage }()
+
+	krakenConfig.Set("container.pull", pullMissing)
+	defer krakenConfig.Set("container.pull", pullAlways)
+
+	// a locally built image has no repository digest
+	rt := newFakeRuntime()
+	rt.Images[containerImage] = types.ImageInspect{ID: "sha256:local"}
+	defer useFakeRuntime(rt)()
+
+	run := func(action string) (int, error) {
+		return runKrakenLibCommand(action, "testing ", []string{"true"}, "", func([]byte) {}, func([]byte) {})
+	}
+
+	if _, err := run(actionUp); err != nil {
+		t.Fatal("Expected up to succeed, got", err)
+	}
+
+	if pinned, err := readImageDigest(getFirstClusterName()); err != nil || pinned != "" {
+		t.Fatal("Expected a local image not to be pinned, got", pinned, err)
+	}
+
+	// clusters pinned to an image ID keep running the configured image
+	if err := writeImageDigest(getFirstClusterName(), "sha256:local"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := run(actionUpdate); err != nil {
+		t.Fatal("Expected update with a local image to succeed, got", err)
+	}
+
+	for _, ref := range rt.Pulled {
+		if strings.HasPrefix(ref, "sha256:") {
+			t.Error("Expected no image to be pulled by ID, got", ref)
+		}
+	}
+}
+
+func TestImageDigestIgnoresOtherRepositories(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.Images["quay.io/samsung_cnct/kraken-lib:local"] = types.ImageInspect{ID: "sha256:local", RepoDigests: []string{"quay.io/someone/else@sha256:aaa"}}
+
+	digest, err := imageDigest(getContext(), rt, "quay.io/samsung_cnct/kraken-lib:local")
+	if err != nil || digest != "sha256:local" {
+		t.Error("Expected the image ID rather than the digest of another repository, got", digest, err)
+	}
+}
+
+func TestImageDigestInUse(t *testing.T) {
+	output, err := ioutil.TempDir("", "kraken-digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+	defer useOutputLocation(output)()
+
+	configPath := filepath.Join(output, "config.yaml")
+	if err := ioutil.WriteFile(configPath, []byte("deployment: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	originalImage := containerImage
+	originalConfigPath := ClusterConfigPath
+	defer func() {
+		containerImage = originalImage
+		ClusterConfigPath = originalConfigPath
+		versionConfigPath = ""
+	}()
+
+	repository := imageRepository(containerImage)
+	rt := newFakeRuntime()
+	rt.Images[containerImage] = types.ImageInspect{ID: "sha256:bbb", RepoDigests: []string{repository + "@sha256:bbb"}}
+	defer useFakeRuntime(rt)()
+
+	if digest, err := imageDigestInUse(); err != nil || digest != repository+"@sha256:bbb (local image)" {
+		t.Error("Expected the digest of the local image without a config, got", digest, err)
+	}
+
+	versionConfigPath = configPath
+	if err := writeImageDigest(getFirstClusterName(), repository+"@sha256:aaa"); err != nil {
+		t.Fatal(err)
+	}
+
+	if digest, err := imageDigestInUse(); err != nil || !strings.HasPrefix(digest, repository+"@sha256:aaa (pinned for cluster") {
+		t.Error("Expected the digest pinned for the cluster, got", digest, err)
+	}
+}
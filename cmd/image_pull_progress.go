@@ -0,0 +1,223 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+)
+
+const (
+	// minimum time between two redraws of the progress on a terminal
+	pullRedrawInterval = 100 * time.Millisecond
+	// time between two plain text summaries when not on a terminal
+	pullSummaryInterval = 10 * time.Second
+)
+
+// pullMessage is one JSON message of an image pull stream.
+type pullMessage struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	Error       string `json:"error"`
+	ErrorDetail *struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+}
+
+// err returns the registry error carried by the message, if any.
+func (m *pullMessage) err() error {
+	if m.ErrorDetail != nil && m.ErrorDetail.Message != "" {
+		return fmt.Errorf("%s", m.ErrorDetail.Message)
+	}
+
+	if m.Error != "" {
+		return fmt.Errorf("%s", m.Error)
+	}
+
+	return nil
+}
+
+type layerProgress struct {
+	status string
+	// size is the compressed layer size, downloaded how much of it has been fetched
+	size       int64
+	downloaded int64
+	// extracted and extractSize follow the extraction once downloaded
+	extracted   int64
+	extractSize int64
+}
+
+func (l *layerProgress) done() bool {
+	return l.status == "Pull complete" || l.status == "Already exists"
+}
+
+// pullProgress follows the layers of an image pull and renders their progress, redrawn
+// in place on a terminal or as periodic plain text summaries otherwise.
+type pullProgress struct {
+	image  string
+	out    io.Writer
+	tty    bool
+	layers map[string]*layerProgress
+	order  []string
+
+	// when the first byte was downloaded, to compute the download rate
+	downloadStart time.Time
+	lastRender    time.Time
+	renderedLines int
+
+	// called once, before the first progress is rendered
+	onStart func()
+}
+
+func newPullProgress(image string, out io.Writer, tty bool) *pullProgress {
+	return &pullProgress{image: image, out: out, tty: tty, layers: map[string]*layerProgress{}}
+}
+
+// update applies a pull message, and renders the progress when due.
+func (p *pullProgress) update(m pullMessage, now time.Time) {
+	// messages without a layer id are about the image as a whole, e.g. "Digest: ..."
+	if m.ID == "" || m.Status == "" || strings.HasPrefix(m.Status, "Pulling from") {
+		return
+	}
+
+	layer, ok := p.layers[m.ID]
+	if !ok {
+		layer = &layerProgress{}
+		p.layers[m.ID] = layer
+		p.order = append(p.order, m.ID)
+	}
+
+	layer.status = m.Status
+	switch m.Status {
+	case "Downloading":
+		if p.downloadStart.IsZero() {
+			p.downloadStart = now
+		}
+		layer.size = m.ProgressDetail.Total
+		layer.downloaded = m.ProgressDetail.Current
+	case "Verifying Checksum", "Download complete":
+		layer.downloaded = layer.size
+	case "Extracting":
+		layer.downloaded = layer.size
+		layer.extractSize = m.ProgressDetail.Total
+		layer.extracted = m.ProgressDetail.Current
+	case "Pull complete":
+		layer.downloaded = layer.size
+		layer.extracted = layer.extractSize
+	}
+
+	interval := pullSummaryInterval
+	if p.tty {
+		interval = pullRedrawInterval
+	}
+
+	if p.lastRender.IsZero() || now.Sub(p.lastRender) >= interval {
+		p.render(now)
+	}
+}
+
+// totals returns the downloaded and total bytes of the layers being downloaded, and
+// how many layers are done out of all of them.
+func (p *pullProgress) totals() (downloaded int64, size int64, done int, count int) {
+	for _, layer := range p.layers {
+		downloaded += layer.downloaded
+		size += layer.size
+		if layer.done() {
+			done++
+		}
+	}
+
+	return downloaded, size, done, len(p.layers)
+}
+
+// eta estimates the remaining download time from the average rate so far.
+func (p *pullProgress) eta(now time.Time) (time.Duration, bool) {
+	downloaded, size, _, _ := p.totals()
+	elapsed := now.Sub(p.downloadStart)
+
+	if p.downloadStart.IsZero() || downloaded == 0 || size <= downloaded || elapsed <= 0 {
+		return 0, false
+	}
+
+	rate := float64(downloaded) / elapsed.Seconds()
+	return time.Duration(float64(size-downloaded)/rate) * time.Second, true
+}
+
+func (p *pullProgress) summary(now time.Time) string {
+	downloaded, size, done, count := p.totals()
+
+	line := fmt.Sprintf("%s: %d/%d layers complete", p.image, done, count)
+	if size > 0 {
+		line += fmt.Sprintf(", %s/%s", units.HumanSize(float64(downloaded)), units.HumanSize(float64(size)))
+	}
+
+	if eta, ok := p.eta(now); ok {
+		line += fmt.Sprintf(", ETA %s", eta)
+	}
+
+	return line
+}
+
+func (l *layerProgress) String() string {
+	switch {
+	case l.status == "Downloading" && l.size > 0:
+		return fmt.Sprintf("%s %s/%s", l.status, units.HumanSize(float64(l.downloaded)), units.HumanSize(float64(l.size)))
+	case l.status == "Extracting" && l.extractSize > 0:
+		return fmt.Sprintf("%s %s/%s", l.status, units.HumanSize(float64(l.extracted)), units.HumanSize(float64(l.extractSize)))
+	}
+
+	return l.status
+}
+
+func (p *pullProgress) render(now time.Time) {
+	if p.onStart != nil {
+		p.onStart()
+		p.onStart = nil
+	}
+
+	p.lastRender = now
+
+	if !p.tty {
+		fmt.Fprintln(p.out, p.summary(now))
+		return
+	}
+
+	// move back over the previous frame and redraw every line of it
+	if p.renderedLines > 0 {
+		fmt.Fprintf(p.out, "\033[%dA", p.renderedLines)
+	}
+
+	for _, id := range p.order {
+		fmt.Fprintf(p.out, "\033[2K%s: %s\n", id, p.layers[id])
+	}
+	fmt.Fprintf(p.out, "\033[2K%s\n", p.summary(now))
+
+	p.renderedLines = len(p.order) + 1
+}
+
+// finish renders the final state of the pull.
+func (p *pullProgress) finish(now time.Time) {
+	if len(p.layers) > 0 {
+		p.render(now)
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func pullMessages(t *testing.T, lines ...string) []pullMessage {
+	var messages []pullMessage
+	for _, line := range lines {
+		var m pullMessage
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, m)
+	}
+
+	return messages
+}
+
+func TestPullProgressSummary(t *testing.T) {
+	var out bytes.Buffer
+	progress := newPullProgress("kraken-lib:latest", &out, false)
+
+	start := time.Now()
+	messages := pullMessages(t,
+		`{"status":"Pulling from samsung_cnct/kraken-lib","id":"latest"}`,
+		`{"status":"Already exists","id":"aaa"}`,
+		`{"status":"Pulling fs layer","id":"bbb"}`,
+		`{"status":"Pulling fs layer","id":"ccc"}`,
+		`{"status":"Downloading","progressDetail":{"current":1000,"total":4000},"id":"bbb"}`,
+		`{"status":"Downloading","progressDetail":{"current":1000,"total":2000},"id":"ccc"}`,
+	)
+	for i, m := range messages {
+		progress.update(m, start.Add(time.Duration(i)*time.Second))
+	}
+
+	// 2000 of 6000 bytes downloaded in the 1s since the first one, 4000 bytes left
+	summary := progress.summary(start.Add(5 * time.Second))
+	expected := "kraken-lib:latest: 1/3 layers complete, 2 kB/6 kB, ETA 2s"
+	if summary != expected {
+		t.Errorf("Expected summary %q, got %q", expected, summary)
+	}
+
+	for _, m := range pullMessages(t,
+		`{"status":"Download complete","id":"bbb"}`,
+		`{"status":"Extracting","progressDetail":{"current":500,"total":8000},"id":"bbb"}`,
+		`{"status":"Pull complete","id":"bbb"}`,
+		`{"status":"Pull complete","id":"ccc"}`,
+		`{"status":"Digest: sha256:0123"}`,
+	) {
+		progress.update(m, start.Add(6*time.Second))
+	}
+	progress.finish(start.Add(20 * time.Second))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatal("Expected a summary when the pull starts and when it ends, got", lines)
+	}
+
+	expected = "kraken-lib:latest: 3/3 layers complete, 6 kB/6 kB"
+	if lines[1] != expected {
+		t.Errorf("Expected final summary %q, got %q", expected, lines[1])
+	}
+}
+
+func TestPullProgressTerminal(t *testing.T) {
+	var out bytes.Buffer
+	progress := newPullProgress("kraken-lib:latest", &out, true)
+
+	started := false
+	progress.onStart = func() { started = true }
+
+	start := time.Now()
+	for i, m := range pullMessages(t,
+		`{"status":"Pulling fs layer","id":"bbb"}`,
+		`{"status":"Downloading","progressDetail":{"current":1000,"total":4000},"id":"bbb"}`,
+	) {
+		progress.update(m, start.Add(time.Duration(i)*time.Second))
+	}
+
+	if !started {
+		t.Error("Expected onStart to be called before the first render")
+	}
+
+	if !strings.Contains(out.String(), "\033[2A") {
+		t.Error("Expected the second frame to redraw over the first, got", out.String())
+	}
+
+	if !strings.Contains(out.String(), "bbb: Downloading 1 kB/4 kB") {
+		t.Error("Expected the layer progress, got", out.String())
+	}
+}
+
+func TestPullMessageError(t *testing.T) {
+	messages := pullMessages(t,
+		`{"status":"Downloading","progressDetail":{"current":1,"total":2},"id":"bbb"}`,
+		`{"errorDetail":{"message":"read: connection reset by peer"},"error":"read: connection reset by peer"}`,
+	)
+
+	if err := messages[0].err(); err != nil {
+		t.Error("Expected no error, got", err)
+	}
+
+	if err := messages[1].err(); err == nil || err.Error() != "read: connection reset by peer" {
+		t.Error("Expected the registry error, got", err)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// run logs kept per cluster unless logs.maxCount is set in kraken.config
+const defaultLogRetentionCount = 50
+
+const runLogExtension string = ".log"
+
+var logsLast bool
+var logsID string
+
+// runLogsDir is where the logs of the actions run against a cluster are kept.
+func runLogsDir(clusterName string) string {
+	return filepath.Join(outputLocation, clusterName, "logs")
+}
+
+// runLogPath is the log of the run with the given id, named after its start time and action
+// so that the logs sort in the order they were run.
+func runLogPath(clusterName string, id string) string {
+	return filepath.Join(runLogsDir(clusterName), id+runLogExtension)
+}
+
+// runLogs lists the logs of a cluster, oldest first.
+func runLogs(clusterName string) ([]os.FileInfo, error) {
+	entries, err := ioutil.ReadDir(runLogsDir(clusterName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []os.FileInfo
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() && strings.HasSuffix(entry.Name(), runLogExtension) {
+			logs = append(logs, entry)
+		}
+	}
+
+	return logs, nil
+}
+
+// pruneRunLogs applies the retention settings of kraken.config to the logs of a cluster:
+// logs.maxCount, the number of logs to keep, and logs.maxAge, how long to keep them.
+// Zero means no limit.
+func pruneRunLogs(clusterName string, now time.Time) error {
+	maxCount := defaultLogRetentionCount
+	if krakenConfig.IsSet("logs.maxCount") {
+		maxCount = krakenConfig.GetInt("logs.maxCount")
+	}
+	maxAge := krakenConfig.GetDuration("logs.maxAge")
+
+	logs, err := runLogs(clusterName)
+	if err != nil {
+		return err
+	}
+
+	for i, log := range logs {
+		tooMany := maxCount > 0 && len(logs)-i > maxCount
+		tooOld := maxAge > 0 && now.Sub(log.ModTime()) > maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(runLogsDir(clusterName), log.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func printLogFile(logFilePath string) error {
+	logFile, err := os.Open(logFilePath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("log %s no longer exists, it may have been removed by the log retention settings", logFilePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	defer Close(logFile)
+
+	_, err = io.Copy(os.Stdout, logFile)
+	return err
+}
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs <cluster name>",
+	Short: "List or print the logs of the actions run against a Kraken cluster",
+	Long: `Lists the logs saved by the up, update, down and ssh refresh actions run against
+	a Kraken cluster, or prints one of them with --last or --id`,
+	SilenceErrors: true,
+	SilenceUsage:  false,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("Please pass the name of one cluster")
+		}
+
+		if logsLast && logsID != "" {
+			return fmt.Errorf("Please pass only one of --last and --id")
+		}
+
+		cmd.SilenceUsage = true
+
+		clusterName := args[0]
+		if logsID != "" {
+			if err := printLogFile(runLogPath(clusterName, strings.TrimSuffix(logsID, runLogExtension))); err != nil {
+				return err
+			}
+
+			ExitCode = 0
+			return nil
+		}
+
+		logs, err := runLogs(clusterName)
+		if err != nil {
+			return err
+		}
+
+		if len(logs) == 0 {
+			return fmt.Errorf("no logs found for cluster '%s' in %s", clusterName, runLogsDir(clusterName))
+		}
+
+		if logsLast {
+			if err := printLogFile(filepath.Join(runLogsDir(clusterName), logs[len(logs)-1].Name())); err != nil {
+				return err
+			}
+
+			ExitCode = 0
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tMODIFIED\tSIZE")
+		for _, log := range logs {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", strings.TrimSuffix(log.Name(), runLogExtension), log.ModTime().Format("2006-01-02 15:04:05"), log.Size())
+		}
+		w.Flush()
+
+		ExitCode = 0
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().BoolVar(
+		&logsLast,
+		"last",
+		false,
+		"print the log of the last action")
+	logsCmd.Flags().StringVar(
+		&logsID,
+		"id",
+		"",
+		"print the log of the action with this id, as listed by 'kraken logs' or 'kraken cluster history'")
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPruneRunLogs(t *testing.T) {
+	output, err := ioutil.TempDir("", "kraken-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+	defer useOutputLocation(output)()
+
+	clusterName := "retention"
+	if err := os.MkdirAll(runLogsDir(clusterName), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	ids := []string{"20171001-100000-up", "20171002-100000-update", "20171003-100000-update", "20171004-100000-down"}
+	for i, id := range ids {
+		if err := ioutil.WriteFile(runLogPath(clusterName, id), []byte(id), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		modified := now.Add(time.Duration(i-len(ids)) * 24 * time.Hour)
+		if err := os.Chtimes(runLogPath(clusterName, id), modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	remaining := func() []string {
+		logs, err := runLogs(clusterName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, log := range logs {
+			names = append(names, log.Name())
+		}
+		return names
+	}
+
+	krakenConfig.Set("logs.maxCount", 3)
+	defer krakenConfig.Set("logs.maxCount", defaultLogRetentionCount)
+	if err := pruneRunLogs(clusterName, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := remaining(); len(names) != 3 || names[0] != ids[1]+runLogExtension {
+		t.Error("Expected the oldest log to be removed, got", names)
+	}
+
+	krakenConfig.Set("logs.maxAge", "36h")
+	defer krakenConfig.Set("logs.maxAge", "0")
+	if err := pruneRunLogs(clusterName, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := remaining(); len(names) != 1 || names[0] != ids[3]+runLogExtension {
+		t.Error("Expected only the log of the last day to be kept, got", names)
+	}
+}
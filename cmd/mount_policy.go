@@ -0,0 +1,322 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// modes of a bind mount
+const (
+	mountReadOnly  string = "ro"
+	mountReadWrite string = "rw"
+)
+
+// subtreeSuffix ends a mount policy pattern matching everything below a directory, but
+// not the directory itself.
+const subtreeSuffix string = "/**"
+
+var configEnvRegex = regexp.MustCompile(`\$[A-Za-z0-9_]+`)
+
+// plannedMount is a host path mounted in the kraken-lib container, and why.
+type plannedMount struct {
+	HostPath      string
+	ContainerPath string
+	Mode          string
+	Reason        string
+}
+
+func (m plannedMount) bind() string {
+	return m.HostPath + ":" + m.ContainerPath + ":" + m.Mode
+}
+
+// skippedMount is a path found in the cluster config that is not mounted, and why.
+type skippedMount struct {
+	Path   string
+	Reason string
+}
+
+// mountPlan is everything mounted in the kraken-lib container, and the paths of the cluster
+// config left out of it.
+type mountPlan struct {
+	Mounts  []plannedMount
+	Skipped []skippedMount
+}
+
+func (p *mountPlan) add(mount plannedMount) {
+	for _, m := range p.Mounts {
+		if m.HostPath == mount.HostPath && m.ContainerPath == mount.ContainerPath {
+			return
+		}
+	}
+
+	p.Mounts = append(p.Mounts, mount)
+}
+
+func (p *mountPlan) binds() []string {
+	binds := make([]string, 0, len(p.Mounts))
+	for _, m := range p.Mounts {
+		binds = append(binds, m.bind())
+	}
+
+	return binds
+}
+
+// mountPolicy decides which of the paths found in the cluster config are mounted, with
+// the patterns of 'mounts.allow' and 'mounts.deny' in kraken.config. A pattern ending in
+// /** matches everything below a directory, others are matched as filepath.Match globs.
+type mountPolicy struct {
+	allow []string
+	deny  []string
+}
+
+// newMountPolicy reads the mount policy of kraken.config. Without 'mounts.allow', paths
+// below the home directory and below the directory of the cluster config are allowed.
+func newMountPolicy(clusterConfigPath string) mountPolicy {
+	allow := krakenConfig.GetStringSlice("mounts.allow")
+	if !krakenConfig.IsSet("mounts.allow") {
+		allow = []string{"$HOME" + subtreeSuffix}
+		if dir, err := filepath.Abs(filepath.Dir(clusterConfigPath)); err == nil {
+			allow = append(allow, dir+subtreeSuffix)
+		}
+	}
+
+	return mountPolicy{
+		allow: expandPatterns(allow),
+		deny:  expandPatterns(krakenConfig.GetStringSlice("mounts.deny")),
+	}
+}
+
+// expandPatterns expands the environment variables of patterns. The directories of /**
+// patterns are resolved like the paths they are matched against, so a home directory that
+// is a symbolic link still allows what is below it.
+func expandPatterns(patterns []string) []string {
+	expanded := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = filepath.Clean(os.ExpandEnv(pattern))
+		if strings.HasSuffix(pattern, subtreeSuffix) {
+			if dir, err := filepath.EvalSymlinks(strings.TrimSuffix(pattern, subtreeSuffix)); err == nil && dir != "/" {
+				pattern = dir + subtreeSuffix
+			}
+		}
+		expanded = append(expanded, pattern)
+	}
+
+	return expanded
+}
+
+// matchPattern reports whether path matches a mount policy pattern.
+func matchPattern(pattern string, path string) bool {
+	if strings.HasSuffix(pattern, subtreeSuffix) {
+		dir := filepath.Clean(strings.TrimSuffix(pattern, subtreeSuffix) + string(filepath.Separator))
+		prefix := strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+		return strings.HasPrefix(path, prefix) && path != dir
+	}
+
+	matched, err := filepath.Match(pattern, path)
+	return err == nil && matched
+}
+
+// denied reports whether path is denied by 'mounts.deny', and why.
+func (p mountPolicy) denied(path string) (bool, string) {
+	for _, pattern := range p.deny {
+		if matchPattern(pattern, path) {
+			return true, "denied by mounts.deny " + pattern
+		}
+	}
+
+	return false, ""
+}
+
+// check reports whether path may be mounted, and why.
+func (p mountPolicy) check(path string) (bool, string) {
+	if denied, why := p.denied(path); denied {
+		return false, why
+	}
+
+	for _, pattern := range p.allow {
+		if matchPattern(pattern, path) {
+			return true, "allowed by mounts.allow " + pattern
+		}
+	}
+
+	return false, "not allowed by mounts.allow"
+}
+
+// planMounts works out what the kraken-lib container for clusterConfigPath mounts: the
+// cluster config read-only, the output folder read-write, the existing paths the cluster
+// config refers to read-write if the mount policy allows them, the CA bundle read-only and
+// the mounts of kraken.config and --mount as given. It also returns the host environment
+// variables the cluster config refers to.
+func planMounts(clusterConfigPath string) (*mountPlan, []string, error) {
+	plan := &mountPlan{}
+	configEnvs := []string{}
+
+	if len(strings.TrimSpace(clusterConfigPath)) > 0 {
+		plan.add(plannedMount{clusterConfigPath, clusterConfigPath, mountReadOnly, "cluster config"})
+	}
+	plan.add(plannedMount{outputLocation, outputLocation, mountReadWrite, "output folder"})
+
+	if len(strings.TrimSpace(clusterConfigPath)) > 0 {
+		policy := newMountPolicy(clusterConfigPath)
+		walkConfig("deployment", clusterConfig.Get("deployment"), func(key string, value string) {
+			for _, match := range configEnvRegex.FindAllString(value, -1) {
+				configEnvs = append(configEnvs, strings.TrimPrefix(match, "$")+"="+os.ExpandEnv(match))
+			}
+
+			path := os.ExpandEnv(value)
+			if !filepath.IsAbs(path) {
+				return
+			}
+			path = filepath.Clean(path)
+			if path == filepath.Clean(outputLocation) || matchPattern(filepath.Clean(outputLocation)+subtreeSuffix, path) {
+				return
+			}
+
+			// the policy applies to what a path links to, which is what gets mounted
+			resolved, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				return
+			}
+
+			reason := "found at " + key
+			if resolved != path {
+				reason += ", links to " + resolved
+			}
+
+			if denied, why := policy.denied(path); denied {
+				plan.Skipped = append(plan.Skipped, skippedMount{path, reason + ", " + why})
+			} else if ok, why := policy.check(resolved); ok {
+				plan.add(plannedMount{resolved, path, mountReadWrite, reason + ", " + why})
+			} else {
+				plan.Skipped = append(plan.Skipped, skippedMount{path, reason + ", " + why})
+			}
+		})
+	}
+
+	bundle, err := caBundlePath()
+	if err != nil {
+		return nil, nil, err
+	}
+	if bundle != "" {
+		plan.add(plannedMount{bundle, bundle, mountReadOnly, "CA bundle"})
+	}
+
+	mounts, err := extraMounts()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, mount := range mounts {
+		plan.add(mount)
+	}
+
+	return plan, configEnvs, nil
+}
+
+// walkConfig calls visit with every string in value, a part of the cluster config, and
+// the key it was found at.
+func walkConfig(key string, value interface{}, visit func(key string, value string)) {
+	switch v := value.(type) {
+	case string:
+		visit(key, v)
+	case []interface{}:
+		for i, item := range v {
+			walkConfig(fmt.Sprintf("%s[%d]", key, i), item, visit)
+		}
+	case map[interface{}]interface{}:
+		keys := make([]string, 0, len(v))
+		items := map[string]interface{}{}
+		for k, item := range v {
+			keys = append(keys, fmt.Sprint(k))
+			items[fmt.Sprint(k)] = item
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkConfig(key+"."+k, items[k], visit)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkConfig(key+"."+k, v[k], visit)
+		}
+	}
+}
+
+func printMountPlan(out io.Writer, plan *mountPlan) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST PATH\tCONTAINER PATH\tMODE\tREASON")
+	for _, m := range plan.Mounts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.HostPath, m.ContainerPath, m.Mode, m.Reason)
+	}
+	w.Flush()
+
+	if len(plan.Skipped) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out, "\nNot mounted:")
+	w = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tREASON")
+	for _, s := range plan.Skipped {
+		fmt.Fprintf(w, "%s\t%s\n", s.Path, s.Reason)
+	}
+	w.Flush()
+}
+
+// mountsCmd represents the mounts command
+var mountsCmd = &cobra.Command{
+	Use:   "mounts",
+	Short: "List what the kraken-lib container of a Kraken cluster mounts",
+	Long: `Lists the host paths mounted in the kraken-lib container for the Kraken cluster
+	described in the specified configuration yaml, with their mode and the reason they are
+	mounted, and the paths of the configuration that the mount policy leaves out`,
+	SilenceErrors: true,
+	SilenceUsage:  false,
+	PreRunE:       preRunGetClusterConfig,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// we do not support any additional arguments, we error out then if there are.
+		if len(args) > 0 {
+			return fmt.Errorf("Unexpected argument(s) passed %v", args)
+		}
+
+		cmd.SilenceUsage = true
+
+		plan, _, err := planMounts(ClusterConfigPath)
+		if err != nil {
+			return err
+		}
+
+		printMountPlan(os.Stdout, plan)
+		ExitCode = 0
+		return nil
+	},
+}
+
+func init() {
+	clusterCmd.AddCommand(mountsCmd)
+}
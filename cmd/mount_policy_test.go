@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"/home/user/**", "/home/user/.ssh/id_rsa", true},
+		{"/home/user/**", "/home/user", false},
+		{"/home/user/**", "/home/username/key", false},
+		{"/**", "/", false},
+		{"/**", "/etc", true},
+		{"/etc/*.pem", "/etc/ca.pem", true},
+		{"/etc/*.pem", "/etc/ssl/ca.pem", false},
+	}
+
+	for _, c := range cases {
+		if matchPattern(c.pattern, c.path) != c.match {
+			t.Errorf("Expected pattern %s matching %s to be %v", c.pattern, c.path, c.match)
+		}
+	}
+}
+
+func TestPlanMounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kraken-mounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "output")
+	keys := filepath.Join(dir, "keys")
+	secrets := filepath.Join(dir, "keys", "secrets")
+	for _, d := range []string{output, secrets} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer useOutputLocation(output)()
+
+	// links below allowed directories to paths that are not allowed
+	linkRoot := filepath.Join(dir, "root")
+	linkEtc := filepath.Join(dir, "etc")
+	linkKeys := filepath.Join(dir, "ssh")
+	for link, target := range map[string]string{linkRoot: "/", linkEtc: "/etc", linkKeys: keys} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configPath := filepath.Join(dir, "config.yaml")
+	config := "deployment:\n" +
+		"  clusters:\n" +
+		"  - name: mounts\n" +
+		"    keys: " + keys + "\n" +
+		"    secrets: " + secrets + "\n" +
+		"    root: /\n" +
+		"    state: " + filepath.Join(output, "mounts") + "\n" +
+		"    home: $HOME\n" +
+		"    linkRoot: " + linkRoot + "\n" +
+		"    linkEtc: " + linkEtc + "\n" +
+		"    linkKeys: " + linkKeys + "\n"
+	if err := ioutil.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(original *viper.Viper) { clusterConfig = original }(clusterConfig)
+	clusterConfig = viper.New()
+	if err := initClusterConfig(configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	krakenConfig.Set("mounts.deny", []string{secrets})
+	defer krakenConfig.Set("mounts.deny", []string{})
+
+	plan, configEnvs, err := planMounts(configPath)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	expected := []string{configPath + ":" + configPath + ":ro", output + ":" + output + ":rw", keys + ":" + keys + ":rw", keys + ":" + linkKeys + ":rw"}
+	binds := plan.binds()
+	if len(binds) != len(expected) {
+		t.Fatal("Expected binds", expected, "got", binds)
+	}
+	for i := range expected {
+		if binds[i] != expected[i] {
+			t.Error("Expected bind", expected[i], "got", binds[i])
+		}
+	}
+
+	skipped := map[string]bool{}
+	for _, s := range plan.Skipped {
+		skipped[s.Path] = true
+	}
+	if !skipped[secrets] || !skipped["/"] || !skipped[os.Getenv("HOME")] || len(plan.Skipped) != 5 {
+		t.Errorf("Expected the denied path, / and the home directory to be skipped, got %+v", plan.Skipped)
+	}
+	if !skipped[linkRoot] || !skipped[linkEtc] {
+		t.Errorf("Expected links to / and /etc to be skipped, got %+v", plan.Skipped)
+	}
+
+	if len(configEnvs) != 1 || configEnvs[0] != "HOME="+os.Getenv("HOME") {
+		t.Error("Expected the HOME variable of the config, got", configEnvs)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var resumeAction bool
+
+func addResumeFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(
+		&resumeAction,
+		"resume",
+		false,
+		"start at the task the last run of this action failed in, if the config file did not change since")
+}
+
+// resumeCommand is command starting at the task the last run of action failed in. It refuses
+// to resume a run that did not fail, or that ran with another cluster config.
+func resumeCommand(action string, command []string, clusterConfigPath string) ([]string, error) {
+	clusterName := getFirstClusterName()
+	records, err := readHistory(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	var last *historyRecord
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Action == action {
+			last = &records[i]
+			break
+		}
+	}
+
+	if last == nil {
+		return nil, fmt.Errorf("cannot resume: there is no '%s' in the history of cluster '%s'", action, clusterName)
+	}
+
+	if last.ExitCode == 0 {
+		return nil, fmt.Errorf("cannot resume: the last '%s' of cluster '%s' (%s) did not fail", action, clusterName, last.ID)
+	}
+
+	if last.FailedTask == "" {
+		return nil, fmt.Errorf("cannot resume: no failed task was recorded for %s", last.ID)
+	}
+
+	hash, err := fileHash(clusterConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash != last.ConfigHash {
+		return nil, fmt.Errorf("cannot resume: %s changed since %s failed, run '%s' from the start", clusterConfigPath, last.ID, action)
+	}
+
+	fmt.Printf("Resuming %s at task '%s' \n", last.ID, last.FailedTask)
+	return append(append([]string{}, command...), "--start-at-task", last.FailedTask), nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestResumeCommand(t *testing.T) {
+	output, err := ioutil.TempDir("", "kraken-resume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+	defer useOutputLocation(output)()
+
+	configPath := filepath.Join(output, "config.yaml")
+	if err := ioutil.WriteFile(configPath, []byte("deployment: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	command := []string{"ansible-playbook", "ansible/up.yaml", "--tags", "all"}
+	if _, err := resumeCommand(actionUp, command, configPath); err == nil {
+		t.Error("Expected nothing to resume without history")
+	}
+
+	rt := newFakeRuntime()
+	rt.Run = func(config *container.Config) (string, int) {
+		// only the events tell the failed task
+		return ansibleEventLine(ansibleEvent{Event: "task_start", Role: "kraken.provider/kraken.provider.aws", Task: "kraken.provider/kraken.provider.aws : Create VPC"}) +
+			ansibleEventLine(ansibleEvent{Event: "result", Task: "kraken.provider/kraken.provider.aws : Create VPC", Host: "localhost", Status: "failed", Msg: "limit"}) +
+			"fatal: [localhost]: FAILED! => {\"msg\": \"limit\"}\n", 2
+	}
+	defer useFakeRuntime(rt)()
+
+	if _, err := runKrakenLibCommand(actionUp, "testing ", command, configPath, func([]byte) {}, func([]byte) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := resumeCommand(actionUp, command, configPath)
+	if err != nil {
+		t.Fatal("Expected the failed up to be resumed, got", err)
+	}
+
+	if strings.Join(resumed, " ") != "ansible-playbook ansible/up.yaml --tags all --start-at-task kraken.provider/kraken.provider.aws : Create VPC" {
+		t.Error("Unexpected resumed command", resumed)
+	}
+
+	if _, err := resumeCommand(actionDown, command, configPath); err == nil {
+		t.Error("Expected a down without history not to be resumed")
+	}
+
+	if err := ioutil.WriteFile(configPath, []byte("deployment: {clusters: []}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := resumeCommand(actionUp, command, configPath); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Error("Expected a changed config to be refused, got", err)
+	}
+}
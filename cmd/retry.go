@@ -0,0 +1,127 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// the last stage of a dryrun, which only generates templates locally
+const dryrunLastStage string = "assembler"
+
+var actionRetries int
+var retryBackoff time.Duration
+
+func addRetryFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().IntVar(
+		&actionRetries,
+		"retries",
+		0,
+		"number of times to rerun a failed action, from the stage that failed")
+	cmd.PersistentFlags().DurationVar(
+		&retryBackoff,
+		"retry-backoff",
+		30*time.Second,
+		"how long to wait before the first retry, doubled for every next one")
+}
+
+// isRetryable reports whether the outcome of an action attempt is worth retrying: a
+// kraken-lib failure or a timeout, but no interruption or error running kraken-lib itself.
+func isRetryable(statusCode int, err error) bool {
+	if err == nil {
+		return statusCode != 0
+	}
+
+	_, ok := err.(*timeoutError)
+	return ok
+}
+
+// failedStage finds the stage an attempt failed in, from its timeout, its failed task or
+// its output.
+func failedStage(failure *ansibleFailure, out []byte, err error) string {
+	if timeout, ok := err.(*timeoutError); ok && timeout.Stage != "" {
+		return timeout.Stage
+	}
+
+	if failure != nil && failure.Stage != "" {
+		return failure.Stage
+	}
+
+	return lastStage(out)
+}
+
+// stageSelected reports whether a comma-separated list of tags runs stage: 'all', the
+// stage or a later one, which include their dependencies, '<stage>_only', or 'dryrun'.
+func stageSelected(tagList string, stage string) bool {
+	for _, tag := range strings.Split(tagList, ",") {
+		tag = strings.TrimSpace(tag)
+		switch {
+		case tag == "all":
+			return true
+		case tag == stage+"_only":
+			return true
+		case tag == "dryrun" && stageNumber(stage) <= stageNumber(dryrunLastStage):
+			return true
+		case stageNumber(tag) > 0 && stageNumber(stage) <= stageNumber(tag):
+			return true
+		}
+	}
+
+	return false
+}
+
+// retryTags are the tags rerunning the failed stage and the later stages of tagList,
+// without the stages before it.
+func retryTags(tagList string, stage string) string {
+	var tags []string
+	for _, s := range krakenStages[stageNumber(stage)-1:] {
+		if stageSelected(tagList, s) {
+			tags = append(tags, s+"_only")
+		}
+	}
+
+	if len(tags) == 0 {
+		return stage + "_only"
+	}
+
+	return strings.Join(tags, ",")
+}
+
+// retryCommandTags is command with its --tags replaced to rerun from stage. Commands
+// without tags, or failures without a known stage, are rerun as they are. A resumed
+// command starts over from the beginning of the stage, not at the task it resumed at.
+func retryCommandTags(command []string, stage string) []string {
+	if stageNumber(stage) == 0 {
+		return command
+	}
+
+	var retried []string
+	for i := 0; i < len(command); i++ {
+		switch {
+		case command[i] == "--start-at-task" && i+1 < len(command):
+			i++
+		case command[i] == "--tags" && i+1 < len(command):
+			retried = append(retried, command[i], retryTags(command[i+1], stage))
+			i++
+		default:
+			retried = append(retried, command[i])
+		}
+	}
+
+	return retried
+}
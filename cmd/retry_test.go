@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestRetryTags(t *testing.T) {
+	cases := []struct {
+		tags     string
+		stage    string
+		expected string
+	}{
+		{"all", "readiness", "readiness_only,services_only"},
+		{"provider", "provider", "provider_only"},
+		{"readiness", "provider", "provider_only,ssh_only,readiness_only"},
+		{"provider_only,services_only", "provider", "provider_only,services_only"},
+		{"dryrun", "node", "node_only,assembler_only"},
+		{"config", "provider", "provider_only"},
+	}
+
+	for _, c := range cases {
+		if tags := retryTags(c.tags, c.stage); tags != c.expected {
+			t.Error("For tags", c.tags, "failing in", c.stage, "expected", c.expected, "got", tags)
+		}
+	}
+
+	command := []string{"ansible-playbook", "ansible/up.yaml", "--tags", "all"}
+	if retried := retryCommandTags(command, ""); strings.Join(retried, " ") != "ansible-playbook ansible/up.yaml --tags all" {
+		t.Error("Expected a failure without a stage to rerun the command as is, got", retried)
+	}
+}
+
+func TestRunKrakenLibCommandRetries(t *testing.T) {
+	output, err := ioutil.TempDir("", "kraken-retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+	defer useOutputLocation(output)()
+
+	actionRetries = 2
+	retryBackoff = 0
+	defer func() { actionRetries = 0 }()
+
+	var commands []string
+	rt := newFakeRuntime()
+	rt.Run = func(config *container.Config) (string, int) {
+		commands = append(commands, strings.Join(config.Cmd, " "))
+		if len(commands) == 1 {
+			// only the events tell the failed task and its stage
+			return ansibleEventLine(ansibleEvent{Event: "task_start", Role: "kraken.readiness", Task: "kraken.readiness : Wait for nodes"}) +
+				ansibleEventLine(ansibleEvent{Event: "result", Task: "kraken.readiness : Wait for nodes", Host: "localhost", Status: "failed", Msg: "timed out"}) +
+				"fatal: [localhost]: FAILED! => {\"msg\": \"timed out\"}\n", 2
+		}
+		return "PLAY RECAP\n", 0
+	}
+	defer useFakeRuntime(rt)()
+
+	var failed, succeeded bool
+	statusCode, err := runKrakenLibCommand(actionUp, "testing ", []string{"ansible-playbook", "ansible/up.yaml", "--tags", "all"}, "",
+		func([]byte) { failed = true }, func([]byte) { succeeded = true })
+	if err != nil || statusCode != 0 {
+		t.Fatal("Expected the retry to succeed, got", statusCode, err)
+	}
+
+	if failed || !succeeded {
+		t.Error("Expected only the outcome of the last attempt to be reported")
+	}
+
+	if len(commands) != 2 || commands[1] != "ansible-playbook ansible/up.yaml --tags readiness_only,services_only" {
+		t.Error("Expected the retry to start from the failed stage, got", commands)
+	}
+
+	records, err := readHistory(getFirstClusterName())
+	if err != nil || len(records) != 2 {
+		t.Fatal("Expected both attempts to be recorded, got", records, err)
+	}
+
+	if records[0].ExitCode != 2 || records[1].Attempt != 2 || records[1].ExitCode != 0 || records[1].Tags != "readiness_only,services_only" {
+		t.Errorf("Unexpected attempt records %+v", records)
+	}
+}
@@ -34,6 +34,10 @@ var containerImage string
 var outputLocation string
 var actionTimeout int
 var dockerClient DockerClientConfig
+var execMode string
+var krakenlibDir string
+var pullPolicy string
+var krakenlibUser string
 
 // ExitCode is used by commands and subcommands to write out main's exitcode
 var ExitCode int
@@ -77,6 +81,9 @@ var RootCmd = &cobra.Command{
 func Execute() {
 	if err := RootCmd.Execute(); err != nil {
 		fmt.Println(err)
+		if interrupted, ok := err.(*interruptedError); ok {
+			os.Exit(interrupted.exitCode())
+		}
 		os.Exit(-1)
 	}
 }
@@ -100,6 +107,7 @@ func init() {
 		TLSCACertificate: "",
 		TLSCertificate:   "",
 		TLSKey:           "",
+		Runtime:          "",
 	}
 	// Global flags
 	RootCmd.PersistentFlags().StringVarP(
@@ -114,6 +122,66 @@ func init() {
 		"i",
 		"quay.io/samsung_cnct/kraken-lib:"+KrakenlibTag,
 		"Krakenlib container image")
+	RootCmd.PersistentFlags().StringVar(
+		&pullPolicy,
+		"pull",
+		pullAlways,
+		"When to pull the krakenlib container image: always, missing or never")
+	RootCmd.PersistentFlags().StringVar(
+		&krakenlibUser,
+		"container-user",
+		containerUserRoot,
+		"User to run the krakenlib container as: 'root', giving the files it writes to the invoking user afterwards, 'host' for the invoking user, or <uid>[:<gid>]")
+	RootCmd.PersistentFlags().StringVar(
+		&containerMemory,
+		"memory",
+		"",
+		"Memory limit of the krakenlib container, e.g. 2g (default no limit)")
+	RootCmd.PersistentFlags().StringVar(
+		&containerCPUs,
+		"cpus",
+		"",
+		"Number of CPUs the krakenlib container may use, e.g. 1.5 (default no limit)")
+	RootCmd.PersistentFlags().StringVar(
+		&containerNetwork,
+		"network",
+		"",
+		"Network mode of the krakenlib container, e.g. host (default the runtime's default network)")
+	RootCmd.PersistentFlags().StringSliceVar(
+		&containerDNS,
+		"dns",
+		nil,
+		"DNS servers of the krakenlib container")
+	RootCmd.PersistentFlags().StringSliceVar(
+		&containerExtraHosts,
+		"add-host",
+		nil,
+		"Extra host:ip entries for the /etc/hosts of the krakenlib container")
+	RootCmd.PersistentFlags().IntVar(
+		&ansibleForks,
+		"forks",
+		0,
+		"Number of parallel processes ansible uses (default ansible's own)")
+	RootCmd.PersistentFlags().StringArrayVar(
+		&containerEnv,
+		"env",
+		nil,
+		"Environment variable KEY=VALUE to set in the krakenlib container, or KEY to pass on the host value")
+	RootCmd.PersistentFlags().StringArrayVar(
+		&containerEnvFiles,
+		"env-file",
+		nil,
+		"File of KEY=VALUE lines to set in the krakenlib container")
+	RootCmd.PersistentFlags().StringArrayVar(
+		&containerMounts,
+		"mount",
+		nil,
+		"Host path to mount in the krakenlib container, as host:container[:ro|rw]")
+	RootCmd.PersistentFlags().StringVar(
+		&caBundle,
+		"ca-bundle",
+		"",
+		"PEM file of CA certificates kraken-lib trusts, e.g. of a corporate proxy")
 	RootCmd.PersistentFlags().StringVarP(
 		&outputLocation,
 		"output",
@@ -129,6 +197,13 @@ func init() {
 		dockerClient.GetDefaultHost(),
 		"Docker host address")
 
+	// Which engine is listening on the docker host; auto-detected when empty
+	RootCmd.PersistentFlags().StringVar(
+		&dockerClient.Runtime,
+		"runtime",
+		"",
+		"Container runtime: docker or podman (default auto-detect)")
+
 	// Is TLS supported on the API connection?
 	RootCmd.PersistentFlags().BoolVar(
 		&dockerClient.TLSEnabled,
@@ -164,12 +239,23 @@ func init() {
 		dockerClient.GetDefaultTLSKey(),
 		"Path to the TLS key file")
 
+	RootCmd.PersistentFlags().StringVar(
+		&execMode,
+		"exec-mode",
+		execModeContainer,
+		"Run kraken-lib in its 'container' or as 'native' local processes from --krakenlib-dir")
+	RootCmd.PersistentFlags().StringVar(
+		&krakenlibDir,
+		"krakenlib-dir",
+		"",
+		"Path to a kraken-lib checkout, used with --exec-mode=native")
+
 	RootCmd.PersistentFlags().IntVarP(
 		&actionTimeout,
 		"timeout",
 		"t",
 		1200,
-		"timeout (in seconds) for container actions")
+		"timeout (in seconds) for container actions, overrides the per-command timeouts (up, update and down 1h, kubectl 5m, helm 10m) and those of kraken.config")
 	RootCmd.PersistentFlags().BoolVarP(
 		&keepAlive,
 		"keep-alive",
@@ -202,13 +288,25 @@ func initKrakenConfig() {
 	// first bind flags
 	krakenConfig.BindPFlag("kraken.config", RootCmd.Flags().Lookup("kraken"))
 	krakenConfig.BindPFlag("container.image", RootCmd.Flags().Lookup("image"))
+	krakenConfig.BindPFlag("container.pull", RootCmd.Flags().Lookup("pull"))
+	krakenConfig.BindPFlag("container.user", RootCmd.Flags().Lookup("container-user"))
+	krakenConfig.BindPFlag("container.memory", RootCmd.Flags().Lookup("memory"))
+	krakenConfig.BindPFlag("container.cpus", RootCmd.Flags().Lookup("cpus"))
+	krakenConfig.BindPFlag("container.network", RootCmd.Flags().Lookup("network"))
+	krakenConfig.BindPFlag("container.dns", RootCmd.Flags().Lookup("dns"))
+	krakenConfig.BindPFlag("container.extraHosts", RootCmd.Flags().Lookup("add-host"))
+	krakenConfig.BindPFlag("ansible.forks", RootCmd.Flags().Lookup("forks"))
 	krakenConfig.BindPFlag("output.dir", RootCmd.Flags().Lookup("output"))
 	krakenConfig.BindPFlag("docker-host", RootCmd.Flags().Lookup("docker-host"))
-	krakenConfig.BindPFlag("tls", RootCmd.Flags().Lookup("tls"))
+	krakenConfig.BindPFlag("runtime", RootCmd.Flags().Lookup("runtime"))
+	krakenConfig.BindPFlag("tls.enabled", RootCmd.Flags().Lookup("tls"))
 	krakenConfig.BindPFlag("tlsverify", RootCmd.Flags().Lookup("tlsverify"))
 	krakenConfig.BindPFlag("tlscacert", RootCmd.Flags().Lookup("tlscacert"))
 	krakenConfig.BindPFlag("tlscert", RootCmd.Flags().Lookup("tlscert"))
 	krakenConfig.BindPFlag("tlskey", RootCmd.Flags().Lookup("tlskey"))
+	krakenConfig.BindPFlag("tls.caBundle", RootCmd.Flags().Lookup("ca-bundle"))
+	krakenConfig.BindPFlag("exec-mode", RootCmd.Flags().Lookup("exec-mode"))
+	krakenConfig.BindPFlag("krakenlib-dir", RootCmd.Flags().Lookup("krakenlib-dir"))
 	krakenConfig.BindPFlag("timeout", RootCmd.Flags().Lookup("timeout"))
 	krakenConfig.BindPFlag("keep-alive", RootCmd.Flags().Lookup("keep-alive"))
 	krakenConfig.BindPFlag("log-path", RootCmd.Flags().Lookup("log-path"))
@@ -0,0 +1,111 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// krakenStages lists the kraken-lib stages in the order the playbooks run them,
+// see 'kraken help topic stages'.
+var krakenStages = []string{
+	"config",
+	"common",
+	"fabric",
+	"etcd",
+	"master",
+	"node",
+	"assembler",
+	"provider",
+	"ssh",
+	"readiness",
+	"services",
+}
+
+// matches ansible task headers such as "TASK [kraken.provider/kraken.provider.aws : Create VPC] ****"
+var taskHeaderRegex = regexp.MustCompile(`^TASK \[(?:(.+?) : )?(.*)\]`)
+
+// stageOfRole maps a kraken-lib role name, e.g. roles/kraken.provider/kraken.provider.aws, to its stage.
+func stageOfRole(role string) string {
+	role = strings.TrimPrefix(role, "roles/")
+	role = strings.SplitN(role, "/", 2)[0]
+
+	if !strings.HasPrefix(role, "kraken.") {
+		return ""
+	}
+
+	name := strings.SplitN(strings.TrimPrefix(role, "kraken."), ".", 2)[0]
+	for _, stage := range krakenStages {
+		if name == stage {
+			return stage
+		}
+	}
+
+	return ""
+}
+
+// parseTaskHeader returns the role and task name of an ansible task header line.
+func parseTaskHeader(line string) (role string, task string, ok bool) {
+	matches := taskHeaderRegex.FindStringSubmatch(line)
+	if matches == nil {
+		return "", "", false
+	}
+
+	return matches[1], matches[2], true
+}
+
+// lastStage returns the stage of the last task that started in an ansible log.
+func lastStage(out []byte) string {
+	stage := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if role, _, ok := parseTaskHeader(scanner.Text()); ok {
+			if s := stageOfRole(role); s != "" {
+				stage = s
+			}
+		}
+	}
+
+	return stage
+}
+
+// fullTaskName is the name ansible gives a task in its header, prefixed with its role if any.
+func fullTaskName(role string, task string) string {
+	if role == "" {
+		return task
+	}
+
+	return role + " : " + task
+}
+
+// lastTask returns the full name of the last task that started in an ansible log.
+func lastTask(out []byte) string {
+	task := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if r, t, ok := parseTaskHeader(scanner.Text()); ok {
+			task = fullTaskName(r, t)
+		}
+	}
+
+	return task
+}
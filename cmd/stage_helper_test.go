@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestStageOfRole(t *testing.T) {
+	cases := map[string]string{
+		"kraken.provider/kraken.provider.aws": "provider",
+		"roles/kraken.readiness":              "readiness",
+		"kraken.config":                       "config",
+		"kraken.unknown":                      "",
+		"common":                              "",
+		"":                                    "",
+	}
+
+	for role, expected := range cases {
+		if stage := stageOfRole(role); stage != expected {
+			t.Error("For role", role, "expected stage", expected, "got", stage)
+		}
+	}
+}
+
+func TestLastStage(t *testing.T) {
+	out := []byte("PLAY [localhost] ****\r\n" +
+		"TASK [kraken.config : Load config] ****\r\n" +
+		"ok: [localhost]\r\n" +
+		"TASK [kraken.provider/kraken.provider.aws : Create VPC] ****\r\n" +
+		"TASK [debug] ****\r\n")
+
+	if stage := lastStage(out); stage != "provider" {
+		t.Error("Expected last stage to be provider, got", stage)
+	}
+
+	if stage := lastStage([]byte("PLAY RECAP")); stage != "" {
+		t.Error("Expected no stage without task headers, got", stage)
+	}
+}
+
+func TestInterruptedExitCode(t *testing.T) {
+	if code := (&interruptedError{signal: os.Interrupt}).exitCode(); code != 130 {
+		t.Error("Expected exit code 130 for SIGINT, got", code)
+	}
+
+	if code := (&interruptedError{signal: syscall.SIGTERM}).exitCode(); code != 143 {
+		t.Error("Expected exit code 143 for SIGTERM, got", code)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/briandowns/spinner"
+)
+
+// longest task name shown on the status line, so that it fits on one terminal line
+const maxStatusTaskLength = 48
+
+// stageProgress follows the ansible events of a kraken-lib action. On a terminal it keeps
+// a status line with the current stage, its elapsed time, the current task and the result
+// counts, in place of the spinner. Otherwise, or when the output is shown, it prints a
+// line whenever a stage starts. It also keeps the last task failure for the summary.
+type stageProgress struct {
+	sync.Mutex
+
+	prefix string
+	out    io.Writer
+	// animated redraws the status line, otherwise only stage changes are printed
+	animated bool
+
+	stage      string
+	stageStart time.Time
+	task       string
+	taskStart  ansibleEvent
+	ok         int
+	changed    int
+	failed     int
+	failure    *ansibleFailure
+
+	frame   int
+	running bool
+	done    bool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func newStageProgress(prefix string, out io.Writer, animated bool) *stageProgress {
+	return &stageProgress{prefix: prefix, out: out, animated: animated}
+}
+
+// Start starts redrawing the status line, or prints the prefix once when not animated.
+func (p *stageProgress) Start() {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.running || p.done {
+		return
+	}
+
+	if !p.animated {
+		if p.prefix != "" {
+			fmt.Fprintln(p.out, p.prefix)
+		}
+		return
+	}
+
+	p.running = true
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+
+	go func() {
+		defer close(p.stopped)
+
+		ticker := time.NewTicker(terminalSpinner.Delay)
+		defer ticker.Stop()
+
+		for {
+			p.Lock()
+			p.redraw(time.Now())
+			p.Unlock()
+
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop clears the status line, reports the last stage and the result counts, and prints
+// finalMsg. Stopping an already stopped progress does nothing.
+func (p *stageProgress) Stop(finalMsg string) {
+	p.Lock()
+	if p.done {
+		p.Unlock()
+		return
+	}
+	p.done = true
+
+	if p.running {
+		p.running = false
+		close(p.stop)
+		p.Unlock()
+		<-p.stopped
+		p.Lock()
+
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+	defer p.Unlock()
+
+	p.finishStage(time.Now())
+	if p.ok+p.failed > 0 {
+		fmt.Fprintf(p.out, "Tasks: ok %d, changed %d, failed %d \n", p.ok, p.changed, p.failed)
+	}
+	fmt.Fprint(p.out, finalMsg)
+}
+
+// handle applies an ansible event, it is called from the goroutine following the logs.
+func (p *stageProgress) handle(e ansibleEvent) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.done {
+		return
+	}
+
+	now := time.Now()
+	switch e.Event {
+	case "task_start":
+		p.task = e.taskName()
+		p.taskStart = e
+		if stage := e.stage(); stage != "" && stage != p.stage {
+			p.startStage(stage, now)
+		}
+	case "result":
+		switch e.Status {
+		case "ok":
+			p.ok++
+			if e.Changed {
+				p.changed++
+			}
+		case "failed", "unreachable":
+			p.failed++
+			p.failure = &ansibleFailure{
+				Play:   e.Play,
+				Role:   p.taskStart.Role,
+				Task:   e.taskName(),
+				Host:   e.Host,
+				Msg:    e.Msg,
+				Stderr: e.Stderr,
+				Stage:  p.stage,
+			}
+		}
+	}
+}
+
+// Failure is the last task failure of the action, if any.
+func (p *stageProgress) Failure() *ansibleFailure {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.failure
+}
+
+// startStage reports the end of the current stage and the start of the next one.
+func (p *stageProgress) startStage(stage string, now time.Time) {
+	if p.animated && p.running {
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+
+	p.finishStage(now)
+	p.stage = stage
+	p.stageStart = now
+
+	if !p.animated {
+		fmt.Fprintf(p.out, "Stage '%s' (%d/%d) started \n", stage, stageNumber(stage), len(krakenStages))
+	}
+}
+
+func (p *stageProgress) finishStage(now time.Time) {
+	if p.stage == "" {
+		return
+	}
+
+	fmt.Fprintf(p.out, "Stage '%s' finished in %s \n", p.stage, now.Sub(p.stageStart).Round(time.Second))
+	p.stage = ""
+}
+
+// status is the status line: the current stage, how long it has been running, the current
+// task and the result counts of the action so far.
+func (p *stageProgress) status(now time.Time) string {
+	if p.stage == "" {
+		return p.prefix
+	}
+
+	task := p.task
+	if len(task) > maxStatusTaskLength {
+		task = task[:maxStatusTaskLength-3] + "..."
+	}
+
+	return fmt.Sprintf("%s[%s %d/%d %s] %s (ok %d, changed %d, failed %d) ", p.prefix, p.stage, stageNumber(p.stage), len(krakenStages),
+		now.Sub(p.stageStart).Round(time.Second), task, p.ok, p.changed, p.failed)
+}
+
+func (p *stageProgress) redraw(now time.Time) {
+	chars := spinner.CharSets[7]
+	p.frame = (p.frame + 1) % len(chars)
+
+	fmt.Fprintf(p.out, "\r\033[K%s%s ", p.status(now), chars[p.frame])
+}
+
+// stageNumber is the 1-based position of stage in krakenStages.
+func stageNumber(stage string) int {
+	for i, s := range krakenStages {
+		if s == stage {
+			return i + 1
+		}
+	}
+
+	return 0
+}
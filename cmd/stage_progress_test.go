@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAnsibleEventFilter(t *testing.T) {
+	var out bytes.Buffer
+	var events []ansibleEvent
+	filter := &ansibleEventFilter{out: &out, handle: func(e ansibleEvent) { events = append(events, e) }}
+
+	// events can be split across writes, other output goes through as it comes
+	filter.Write([]byte("[WARNING]: a warning\nKRAKEN-EV"))
+	filter.Write([]byte(`ENT {"event":"task_start","task":"kraken.config : Load config","role":"kraken.config"}` + "\n"))
+	filter.Write([]byte("Password: "))
+
+	if out.String() != "[WARNING]: a warning\nPassword: " {
+		t.Error("Expected only the regular output to go through, got", out.String())
+	}
+
+	if len(events) != 1 || events[0].stage() != "config" || events[0].taskName() != "Load config" {
+		t.Error("Expected one task_start event of stage config, got", events)
+	}
+}
+
+func TestAnsibleEventStage(t *testing.T) {
+	cases := []struct {
+		event ansibleEvent
+		stage string
+	}{
+		{ansibleEvent{Role: "kraken.provider/kraken.provider.aws"}, "provider"},
+		{ansibleEvent{Role: "kraken.readiness"}, "readiness"},
+		{ansibleEvent{Tags: []string{"all", "services"}}, "services"},
+		{ansibleEvent{Tags: []string{"always"}}, ""},
+	}
+
+	for _, c := range cases {
+		if stage := c.event.stage(); stage != c.stage {
+			t.Error("For", c.event, "expected stage", c.stage, "got", stage)
+		}
+	}
+}
+
+func TestStageProgress(t *testing.T) {
+	var out bytes.Buffer
+	progress := newStageProgress("Bringing up cluster 'test' ", &out, false)
+	progress.Start()
+
+	for _, e := range []ansibleEvent{
+		{Event: "task_start", Task: "kraken.config : Load config", Role: "kraken.config"},
+		{Event: "result", Status: "ok"},
+		{Event: "task_start", Task: "kraken.provider/kraken.provider.aws : Create VPC", Role: "kraken.provider/kraken.provider.aws"},
+		{Event: "result", Status: "ok", Changed: true},
+		{Event: "result", Status: "failed"},
+		{Event: "result", Status: "skipped"},
+	} {
+		progress.handle(e)
+	}
+
+	if status := progress.status(progress.stageStart); status != "Bringing up cluster 'test' [provider 8/11 0s] Create VPC (ok 2, changed 1, failed 1) " {
+		t.Error("Unexpected status line", status)
+	}
+
+	progress.Stop("Complete\n")
+	progress.Stop("Complete\n")
+
+	expected := []string{
+		"Bringing up cluster 'test' ",
+		"Stage 'config' (1/11) started ",
+		"Stage 'config' finished in 0s ",
+		"Stage 'provider' (8/11) started ",
+		"Stage 'provider' finished in 0s ",
+		"Tasks: ok 2, changed 1, failed 1 ",
+		"Complete",
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected output\n%s\ngot\n%s", strings.Join(expected, "\n"), out.String())
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+)
+
+// rawModeSupported tells whether makeRaw can put a terminal in raw mode on this platform.
+const rawModeSupported = false
+
+// resizeSignals tell of a change in the size of the terminal, there are none here.
+var resizeSignals []os.Signal
+
+func makeRaw(f *os.File) (func(), error) {
+	return nil, fmt.Errorf("raw terminal mode is not supported on this platform")
+}
+
+func terminalSize(f *os.File) (uint, uint, error) {
+	return 0, 0, fmt.Errorf("terminal size is not supported on this platform")
+}
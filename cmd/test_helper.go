@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"encoding/json"
 	"math/rand"
 	"time"
 )
@@ -32,3 +33,37 @@ func randStringBytesMaskImprSrc(n int) string {
 
 	return string(b)
 }
+
+// useFakeRuntime makes container actions run against rt and returns a func restoring the real runtime.
+// Containers of rt write no files, so they run as if kraken was run by root, who owns them anyway.
+func useFakeRuntime(rt *fakeRuntime) func() {
+	original := newContainerRuntime
+	newContainerRuntime = func() (ContainerRuntime, error) {
+		return rt, nil
+	}
+
+	originalUID := hostUID
+	hostUID = func() int { return 0 }
+
+	return func() {
+		newContainerRuntime = original
+		hostUID = originalUID
+	}
+}
+
+// useOutputLocation makes dir the kraken output folder and returns a func restoring the original one.
+func useOutputLocation(dir string) func() {
+	original := outputLocation
+	outputLocation = dir
+
+	return func() {
+		outputLocation = original
+	}
+}
+
+// ansibleEventLine is the line the kraken_events callback writes for e, for the output of
+// fake containers.
+func ansibleEventLine(e ansibleEvent) string {
+	data, _ := json.Marshal(e)
+	return ansibleEventPrefix + string(data) + "\n"
+}
@@ -0,0 +1,176 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// defaultActionTimeouts are the timeouts of the commands that do not use the --timeout
+// default, unless kraken.config sets 'timeouts.<action>' or 'timeout'.
+var defaultActionTimeouts = map[string]time.Duration{
+	actionUp:      time.Hour,
+	actionUpdate:  time.Hour,
+	actionDown:    time.Hour,
+	actionKubectl: 5 * time.Minute,
+	actionHelm:    10 * time.Minute,
+}
+
+// actionTimeoutFor is how long action may run: the timeout set by the user, if any, then
+// the default of the action, and finally the --timeout default.
+func actionTimeoutFor(action string) time.Duration {
+	if timeout, ok := configuredActionTimeout(action); ok {
+		return timeout
+	}
+
+	if timeout, ok := defaultActionTimeouts[action]; ok {
+		return timeout
+	}
+
+	return time.Duration(actionTimeout) * time.Second
+}
+
+// configuredActionTimeout is the timeout the user set for action: --timeout when it is
+// passed, then the 'timeouts.<action>' duration of kraken.config, then its 'timeout' in
+// seconds.
+func configuredActionTimeout(action string) (time.Duration, bool) {
+	if RootCmd.PersistentFlags().Changed("timeout") {
+		return time.Duration(actionTimeout) * time.Second, true
+	}
+
+	if key := "timeouts." + action; krakenConfig.IsSet(key) {
+		return krakenConfig.GetDuration(key), true
+	}
+
+	if krakenConfig.InConfig("timeout") {
+		return time.Duration(krakenConfig.GetInt("timeout")) * time.Second, true
+	}
+
+	return 0, false
+}
+
+// stageTimeouts are the budgets of the stages set in kraken.config as
+// 'timeouts.stages.<stage>', e.g. 'provider: 30m'.
+func stageTimeouts() map[string]time.Duration {
+	budgets := map[string]time.Duration{}
+	for _, stage := range krakenStages {
+		if key := "timeouts.stages." + stage; krakenConfig.IsSet(key) {
+			budgets[stage] = krakenConfig.GetDuration(key)
+		}
+	}
+
+	return budgets
+}
+
+// timeoutError reports an action stopped for running too long, as a whole or in one stage.
+type timeoutError struct {
+	Action string
+	Stage  string
+	Limit  time.Duration
+	// StageLimit is set when Stage ran out of its own budget
+	StageLimit bool
+}
+
+func (e *timeoutError) Error() string {
+	switch {
+	case e.StageLimit:
+		return fmt.Sprintf("stage '%s' exceeded its %s timeout", e.Stage, e.Limit)
+	case e.Stage != "":
+		return fmt.Sprintf("'%s' exceeded its %s timeout during stage '%s'", e.Action, e.Limit, e.Stage)
+	default:
+		return fmt.Sprintf("'%s' exceeded its %s timeout", e.Action, e.Limit)
+	}
+}
+
+// stageWatch follows the stage transitions of the ansible events of an action, and cancels
+// the action when a stage runs longer than its budget.
+type stageWatch struct {
+	sync.Mutex
+
+	budgets  map[string]time.Duration
+	cancel   context.CancelFunc
+	stage    string
+	timer    *time.Timer
+	exceeded *timeoutError
+}
+
+func newStageWatch(budgets map[string]time.Duration, cancel context.CancelFunc) *stageWatch {
+	return &stageWatch{budgets: budgets, cancel: cancel}
+}
+
+// handle applies an ansible event, it is called from the goroutine following the logs.
+func (w *stageWatch) handle(e ansibleEvent) {
+	if e.Event != "task_start" {
+		return
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	stage := e.stage()
+	if stage == "" || stage == w.stage || w.exceeded != nil {
+		return
+	}
+
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+
+	w.stage = stage
+	if budget, ok := w.budgets[stage]; ok && budget > 0 {
+		w.timer = time.AfterFunc(budget, func() {
+			w.Lock()
+			defer w.Unlock()
+
+			// the stage may have ended while the timer fired
+			if w.stage != stage || w.exceeded != nil {
+				return
+			}
+
+			w.exceeded = &timeoutError{Stage: stage, Limit: budget, StageLimit: true}
+			w.cancel()
+		})
+	}
+}
+
+// Stop stops the timer of the running stage.
+func (w *stageWatch) Stop() {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+// timeout describes why the action of the watched events was stopped: a stage out of
+// budget, or else the action as a whole running longer than limit.
+func (w *stageWatch) timeout(action string, limit time.Duration) *timeoutError {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.exceeded != nil {
+		w.exceeded.Action = action
+		return w.exceeded
+	}
+
+	return &timeoutError{Action: action, Stage: w.stage, Limit: limit}
+}
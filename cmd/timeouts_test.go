@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActionTimeoutFor(t *testing.T) {
+	if timeout := actionTimeoutFor(actionKubectl); timeout != 5*time.Minute {
+		t.Error("Expected the kubectl default of 5m, got", timeout)
+	}
+
+	if timeout := actionTimeoutFor(actionGenerate); timeout != time.Duration(actionTimeout)*time.Second {
+		t.Error("Expected the --timeout default for generate, got", timeout)
+	}
+
+	krakenConfig.Set("timeouts.up", "2h")
+	defer krakenConfig.Set("timeouts.up", time.Hour)
+	if timeout := actionTimeoutFor(actionUp); timeout != 2*time.Hour {
+		t.Error("Expected the kraken.config timeout of up, got", timeout)
+	}
+
+	originalTimeout := actionTimeout
+	defer func() {
+		actionTimeout = originalTimeout
+		RootCmd.PersistentFlags().Lookup("timeout").Changed = false
+	}()
+
+	actionTimeout = 60
+	RootCmd.PersistentFlags().Lookup("timeout").Changed = true
+	if timeout := actionTimeoutFor(actionUp); timeout != time.Minute {
+		t.Error("Expected --timeout to override kraken.config, got", timeout)
+	}
+}
+
+func TestStageWatch(t *testing.T) {
+	cancelled := make(chan struct{})
+	watch := newStageWatch(map[string]time.Duration{"provider": 20 * time.Millisecond}, func() { close(cancelled) })
+	defer watch.Stop()
+
+	watch.handle(ansibleEvent{Event: "task_start", Role: "kraken.config"})
+	if err := watch.timeout(actionUp, time.Hour); err.Error() != "'up' exceeded its 1h0m0s timeout during stage 'config'" {
+		t.Error("Expected the action timeout to name the running stage, got", err)
+	}
+
+	watch.handle(ansibleEvent{Event: "task_start", Role: "kraken.provider/kraken.provider.aws"})
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the action to be cancelled once the stage is out of budget")
+	}
+
+	if err := watch.timeout(actionUp, time.Hour); !err.StageLimit || err.Error() != "stage 'provider' exceeded its 20ms timeout" {
+		t.Error("Expected the stage timeout to be reported, got", err)
+	}
+}
+
+func TestToolContext(t *testing.T) {
+	ctx, cancel := toolContext(actionKubectl, &containerStdio{})
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > 5*time.Minute {
+		t.Error("Expected the kubectl default without stdin, got", deadline, ok)
+	}
+
+	// piped input, as in CI, keeps the default
+	piped := &containerStdio{stdin: strings.NewReader("")}
+	pipedCtx, pipedCancel := toolContext(actionKubectl, piped)
+	defer pipedCancel()
+	if deadline, ok := pipedCtx.Deadline(); !ok || time.Until(deadline) > 5*time.Minute {
+		t.Error("Expected the kubectl default for piped stdin, got", deadline, ok)
+	}
+
+	// an interactive session only stops when the user says so
+	session := &containerStdio{stdin: os.Stdin, terminal: os.Stdin}
+	sessionCtx, sessionCancel := toolContext(actionKubectl, session)
+	defer sessionCancel()
+	if deadline, ok := sessionCtx.Deadline(); ok {
+		t.Error("Expected no default timeout for a session reading stdin, got", deadline)
+	}
+
+	krakenConfig.Set("timeouts.kubectl", "2m")
+	defer krakenConfig.Set("timeouts.kubectl", 5*time.Minute)
+	configuredCtx, configuredCancel := toolContext(actionKubectl, session)
+	defer configuredCancel()
+	if deadline, ok := configuredCtx.Deadline(); !ok || time.Until(deadline) > 2*time.Minute {
+		t.Error("Expected the kraken.config timeout of kubectl for a session, got", deadline, ok)
+	}
+}
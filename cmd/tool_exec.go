@@ -0,0 +1,177 @@
+// Copyright © 2016 Samsung CNCT
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// kubernetesToolsDir holds the tools of each kubernetes version the image supports, in
+// <version>/bin.
+const kubernetesToolsDir string = "/opt/cnct/kubernetes/"
+
+// listBinariesScript prints the path of every executable in the PATH of the image and in
+// the tool folders of its kubernetes versions.
+const listBinariesScript string = `for dir in $(echo "$PATH" | tr ':' ' ') /opt/cnct/kubernetes/*/bin; do
+	[ -d "$dir" ] || continue
+	for file in "$dir"/*; do
+		[ -f "$file" ] && [ -x "$file" ] && echo "$file"
+	done
+done`
+
+var execList bool
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec -- <binary> [args]",
+	Short: "Run any tool of the kraken-lib image with a Kraken cluster",
+	Long: `Runs a binary of the kraken-lib image, such as a cloud CLI, ansible or the tools of a
+	kubernetes version under /opt/cnct/kubernetes, with the Kraken cluster configured by the
+	specified yaml file: its KUBECONFIG, HELM_HOME, cloud credentials and mounts. Kraken flags
+	go before the binary, or before a '--' separating them.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PreRunE:       preRunGetClusterConfig,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !execList && len(args) == 0 {
+			return fmt.Errorf("Please pass the binary to run, or --list to list them")
+		}
+
+		rt, _, err := pullKrakenContainerImage(containerImage)
+		if err != nil {
+			ExitCode = 1
+			return err
+		}
+
+		if execList {
+			binaries, err := listImageBinaries(rt)
+			if err != nil {
+				ExitCode = 1
+				return err
+			}
+
+			printImageBinaries(os.Stdout, binaries)
+			ExitCode = 0
+			return nil
+		}
+
+		// the arguments are the binary's as they were given, quoting and spaces included
+		ExitCode, err = runToolCommand(rt, actionExec, args)
+		return err
+	},
+}
+
+func init() {
+	toolCmd.AddCommand(execCmd)
+
+	execCmd.Flags().BoolVar(
+		&execList,
+		"list",
+		false,
+		"list the binaries of the kraken-lib image and their kubernetes versions")
+
+	// kraken flags come before the binary, so that its own flags are not taken for kraken's
+	execCmd.Flags().SetInterspersed(false)
+}
+
+// imageBinary is an executable of the kraken-lib image.
+type imageBinary struct {
+	Name string
+	// Version is the kubernetes version the binary is for, if it is one of its tools
+	Version string
+	Path    string
+}
+
+// listImageBinaries finds the executables of the kraken-lib image. Native processes run on
+// the host, where there is no image to list.
+func listImageBinaries(rt ContainerRuntime) ([]imageBinary, error) {
+	if krakenConfig.GetString("exec-mode") == execModeNative {
+		return nil, fmt.Errorf("--list is not supported with --exec-mode=%s, the binaries are those of the host", execModeNative)
+	}
+
+	ctx, cancel := getTimedContext(actionExec)
+	defer cancel()
+
+	var output bytes.Buffer
+	command := []string{"sh", "-c", listBinariesScript}
+	_, statusCode, cleanup, err := containerAction(ctx, rt, actionExec, command, ClusterConfigPath, &output, nil, nil)
+	if cleanup != nil {
+		defer cleanup()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != 0 {
+		return nil, fmt.Errorf("listing the binaries of %s exited with %d: %s", containerImage, statusCode, output.String())
+	}
+
+	return parseImageBinaries(&output), nil
+}
+
+// parseImageBinaries reads the executable paths printed by listBinariesScript, sorted by
+// name and kubernetes version.
+func parseImageBinaries(r io.Reader) []imageBinary {
+	var binaries []imageBinary
+	seen := map[string]bool{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		binaryPath := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(binaryPath, "/") || seen[binaryPath] {
+			continue
+		}
+		seen[binaryPath] = true
+
+		binary := imageBinary{Name: path.Base(binaryPath), Path: binaryPath}
+		if strings.HasPrefix(binaryPath, kubernetesToolsDir) {
+			binary.Version = strings.SplitN(strings.TrimPrefix(binaryPath, kubernetesToolsDir), "/", 2)[0]
+		}
+		binaries = append(binaries, binary)
+	}
+
+	sort.SliceStable(binaries, func(i, j int) bool {
+		if binaries[i].Name != binaries[j].Name {
+			return binaries[i].Name < binaries[j].Name
+		}
+		return binaries[i].Version < binaries[j].Version
+	})
+
+	return binaries
+}
+
+func printImageBinaries(out io.Writer, binaries []imageBinary) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKUBERNETES VERSION\tPATH")
+	for _, b := range binaries {
+		version := b.Version
+		if version == "" {
+			version = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", b.Name, version, b.Path)
+	}
+	w.Flush()
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestParseImageBinaries(t *testing.T) {
+	output := "/usr/local/bin/aws\n/usr/bin/ansible-playbook\n/opt/cnct/kubernetes/v1.8/bin/kubectl\n" +
+		"/opt/cnct/kubernetes/v1.7/bin/kubectl\n/usr/local/bin/aws\nnot a path\n"
+
+	expected := []imageBinary{
+		{"ansible-playbook", "", "/usr/bin/ansible-playbook"},
+		{"aws", "", "/usr/local/bin/aws"},
+		{"kubectl", "v1.7", "/opt/cnct/kubernetes/v1.7/bin/kubectl"},
+		{"kubectl", "v1.8", "/opt/cnct/kubernetes/v1.8/bin/kubectl"},
+	}
+
+	if binaries := parseImageBinaries(strings.NewReader(output)); !reflect.DeepEqual(binaries, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, binaries)
+	}
+}
+
+func TestListImageBinaries(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.Run = func(config *container.Config) (string, int) {
+		if len(config.Cmd) != 3 || config.Cmd[0] != "sh" || config.Cmd[2] != listBinariesScript {
+			return "unexpected command", 1
+		}
+		return "/opt/cnct/kubernetes/v1.8/bin/helm\n", 0
+	}
+	defer useFakeRuntime(rt)()
+
+	binaries, err := listImageBinaries(rt)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	var out bytes.Buffer
+	printImageBinaries(&out, binaries)
+	if !strings.Contains(out.String(), "helm  v1.8") {
+		t.Error("Expected helm of kubernetes v1.8 to be listed, got", out.String())
+	}
+}
+
+func TestListImageBinariesNative(t *testing.T) {
+	krakenConfig.Set("exec-mode", execModeNative)
+	defer krakenConfig.Set("exec-mode", execModeContainer)
+
+	rt := newFakeRuntime()
+	if _, err := listImageBinaries(rt); err == nil || !strings.Contains(err.Error(), "--exec-mode=native") {
+		t.Error("Expected --list to be refused in native mode, got", err)
+	}
+
+	if len(rt.Containers) != 0 {
+		t.Error("Expected nothing to run in native mode, got", len(rt.Containers), "containers")
+	}
+}
@@ -16,6 +16,7 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"log"
@@ -24,7 +25,6 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/docker/docker/client"
 	"github.com/spf13/cobra"
 )
 
@@ -39,17 +39,18 @@ var helmCmd = &cobra.Command{
 	Short:         "Use Kubernetes Helm with a Kraken cluster",
 	SilenceUsage:  true,
 	SilenceErrors: true,
-	Long:          `Use Kubernetes Helm with the Kraken cluster configured by the specified yaml file`,
-	PreRunE:       preRunGetClusterConfig,
+	Long: `Use Kubernetes Helm with the Kraken cluster configured by the specified yaml file.
+	Kraken flags go before the helm arguments, or before a '--' separating them.`,
+	PreRunE: preRunGetClusterConfig,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		var err error
 
-		cli, backgroundCtx, err := pullKrakenContainerImage(containerImage)
+		rt, backgroundCtx, err := pullKrakenContainerImage(containerImage)
 		if err != nil {
 			return err
 		}
 
-		minorMajorVersion, err := getK8sVersion(cli)
+		minorMajorVersion, err := getK8sVersion(rt)
 		if err != nil {
 			return err
 		}
@@ -57,19 +58,19 @@ var helmCmd = &cobra.Command{
 		helmPath := path.Join("/opt/cnct/kubernetes/", minorMajorVersion, "/bin/helm")
 
 		// Run helm if available, or get user input if no helm available.
-		verifiedHelmPath, err := verifyHelmPath(helmPath, cli)
+		verifiedHelmPath, err := verifyHelmPath(helmPath, rt)
 		if err != nil {
 			return err
 		}
 
 		if strings.Contains(verifiedHelmPath, minorMajorVersion) {
-			ExitCode, err = runHelm(backgroundCtx, helmPath, cli, args)
+			ExitCode, err = runHelm(helmPath, rt, args)
 			return err
 		}
 
 		fmt.Printf("No version of helm available for Kubernetes %s \n", minorMajorVersion)
 
-		latestHelmVersion, err := latestSupportedHelmVersion(backgroundCtx, cli)
+		latestHelmVersion, err := latestSupportedHelmVersion(backgroundCtx, rt)
 		if err != nil {
 			ExitCode = -1
 			return err
@@ -85,7 +86,7 @@ var helmCmd = &cobra.Command{
 
 		switch strings.ToLower(strings.TrimSpace(response)) {
 		case "y", "yes":
-			ExitCode, err = runHelm(backgroundCtx, helmPath, cli, args)
+			ExitCode, err = runHelm(helmPath, rt, args)
 			return err
 		case "n", "no":
 			fmt.Println("No version of Helm running")
@@ -100,13 +101,16 @@ var helmCmd = &cobra.Command{
 
 func init() {
 	toolCmd.AddCommand(helmCmd)
+
+	// kraken flags come before the helm arguments, so that helm flags are not taken for kraken's
+	helmCmd.Flags().SetInterspersed(false)
 }
 
 // Check to see if path exists, else get latest.
-func verifyHelmPath(helmPath string, cli *client.Client) (string, error) {
+func verifyHelmPath(helmPath string, rt ContainerRuntime) (string, error) {
 	command := []string{"test", "-f", helmPath}
 
-	statusCode, err := runContainerCommand(nil, cli, command, nil)
+	statusCode, err := runContainerCommand(nil, rt, command, nil)
 
 	// Unless command returns 0 (filepath exists), assign path to latest.
 	if statusCode != 0 {
@@ -117,7 +121,7 @@ func verifyHelmPath(helmPath string, cli *client.Client) (string, error) {
 }
 
 // Get the k8s version from Krakenlib
-func getK8sVersion(cli *client.Client) (string, error) {
+func getK8sVersion(rt ContainerRuntime) (string, error) {
 	k8sVersionErr := fmt.Errorf("Error: retrieving k8s version from config file: %s", ClusterConfigPath)
 
 	outputFile := fmt.Sprintf("%s_%s", ClusterConfigPath, tmpFile)
@@ -130,7 +134,7 @@ func getK8sVersion(cli *client.Client) (string, error) {
 		fmt.Sprintf("config_path=%s config_base=%s config_forced=%t kraken_action=max_k8s_version version_outfile=%s", ClusterConfigPath, outputLocation, configForced, outputFile),
 	}
 
-	statusCode, err := runContainerCommand(nil, cli, command, nil)
+	statusCode, err := runContainerCommand(nil, rt, command, nil)
 	if err != nil {
 		return "", err
 	}
@@ -185,22 +189,16 @@ func removePatchVersion(version string) (string, error) {
 }
 
 // Run helm if valid path or if user wants to run latest helm.
-func runHelm(backgroundCtx context.Context, helmPath string, cli *client.Client, args []string) (int, error) {
-	path, err := verifyHelmPath(helmPath, cli)
+func runHelm(helmPath string, rt ContainerRuntime, args []string) (int, error) {
+	path, err := verifyHelmPath(helmPath, rt)
 	if err != nil {
 		return -1, err
 	}
 
-	command := []string{path}
-	for _, element := range args {
-		command = append(command, strings.Split(element, " ")...)
-	}
-
-	onComplete := func(out []byte) {
-		fmt.Printf("%s", out)
-	}
+	// the arguments are helm's as they were given, quoting and spaces included
+	command := append([]string{path}, args...)
 
-	return runContainerCommand(backgroundCtx, cli, command, onComplete)
+	return runToolCommand(rt, actionHelm, command)
 }
 
 func remove(path string) {
@@ -210,7 +208,7 @@ func remove(path string) {
 }
 
 // If no valid helm version, let user know the latest helm version available.
-func latestSupportedHelmVersion(backgroundCtx context.Context, cli *client.Client) (string, error) {
+func latestSupportedHelmVersion(backgroundCtx context.Context, rt ContainerRuntime) (string, error) {
 	var result string
 
 	command := []string{"printenv", "K8S_HELM_VERSION_LATEST"}
@@ -219,35 +217,33 @@ func latestSupportedHelmVersion(backgroundCtx context.Context, cli *client.Clien
 		result = string(out)
 	}
 
-	_, err := runContainerCommand(backgroundCtx, cli, command, onComplete)
+	_, err := runContainerCommand(backgroundCtx, rt, command, onComplete)
 
 	return result, err
 }
 
-func runContainerCommand(backgroundCtx context.Context, cli *client.Client, command []string, onComplete func([]byte)) (int, error) {
+func runContainerCommand(backgroundCtx context.Context, rt ContainerRuntime, command []string, onComplete func([]byte)) (int, error) {
 	var err error
-	ctx, cancel := getTimedContext()
+	ctx, cancel := getTimedContext(actionHelm)
 
 	defer cancel()
 
-	resp, statusCode, timeout, err := containerAction(ctx, cli, command, ClusterConfigPath)
-	if err != nil {
-		return -1, err
+	var output bytes.Buffer
+	_, statusCode, timeout, err := containerAction(ctx, rt, actionHelm, command, ClusterConfigPath, &output, nil, nil)
+	if timeout != nil {
+		defer timeout()
 	}
 
-	defer timeout()
-
-	if backgroundCtx != nil {
-		out, err := printContainerLogs(backgroundCtx, cli, resp)
-
-		if err != nil {
-			return -1, err
-		}
-
-		if onComplete != nil {
-			onComplete(out)
+	if err != nil {
+		switch err.(type) {
+		case *interruptedError, *timeoutError:
+			return statusCode, err
 		}
+		return -1, err
+	}
 
+	if backgroundCtx != nil && onComplete != nil {
+		onComplete(output.Bytes())
 	}
 
 	return statusCode, err
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"testing"
+
+	"github.com/docker/docker/api/types/container"
 )
 
 func TestRemovePatchVersion(t *testing.T) {
@@ -46,3 +48,40 @@ func TestRemovePatchVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestRunContainerCommand(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.Run = func(config *container.Config) (string, int) {
+		return "v2.8.2", 0
+	}
+	defer useFakeRuntime(rt)()
+
+	var result string
+	onComplete := func(out []byte) {
+		result = string(out)
+	}
+
+	statusCode, err := runContainerCommand(getContext(), rt, []string{"printenv", "K8S_HELM_VERSION_LATEST"}, onComplete)
+	if err != nil || statusCode != 0 {
+		t.Fatal("Expected command to succeed, got status", statusCode, "and error", err)
+	}
+
+	if result != "v2.8.2" {
+		t.Error("Expected container output to be passed to onComplete, got", result)
+	}
+
+	// without a context the output is not read
+	result = ""
+	rt.Run = func(config *container.Config) (string, int) {
+		return "missing", 1
+	}
+
+	statusCode, err = runContainerCommand(nil, rt, []string{"test", "-f", "/opt/cnct/kubernetes/v1.8/bin/helm"}, onComplete)
+	if err != nil || statusCode != 1 {
+		t.Error("Expected status 1 without error, got status", statusCode, "and error", err)
+	}
+
+	if result != "" {
+		t.Error("Expected output not to be read without a context, got", result)
+	}
+}
@@ -15,9 +15,6 @@
 package cmd
 
 import (
-	"fmt"
-	"strings"
-
 	"github.com/spf13/cobra"
 )
 
@@ -26,7 +23,8 @@ var kubectlCmd = &cobra.Command{
 	Use:   "kubectl",
 	Short: "Use Kubernetes kubectl with Kraken cluster",
 	Long: `Use Kubernetes kubectl with the Kraken
-	cluster configured by the specified yaml file`,
+	cluster configured by the specified yaml file. Kraken flags go before the kubectl
+	arguments, or before a '--' separating them.`,
 	PreRunE: preRunGetClusterConfig,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		var err error
@@ -45,19 +43,16 @@ var kubectlCmd = &cobra.Command{
 			}
 		}
 
-		for _, element := range args {
-			command = append(command, strings.Split(element, " ")...)
-		}
-
-		onFailure := func(out []byte) {
-			fmt.Printf("%s \n", out)
-		}
+		// the arguments are kubectl's as they were given, quoting and spaces included
+		command = append(command, args...)
 
-		onSuccess := func(out []byte) {
-			fmt.Printf("%s \n", out)
+		rt, _, err := pullKrakenContainerImage(containerImage)
+		if err != nil {
+			ExitCode = 1
+			return err
 		}
 
-		ExitCode, err = runKrakenLibCommandNoSpinner(command, ClusterConfigPath, onFailure, onSuccess)
+		ExitCode, err = runToolCommand(rt, actionKubectl, command)
 
 		return err
 	},
@@ -65,4 +60,8 @@ var kubectlCmd = &cobra.Command{
 
 func init() {
 	toolCmd.AddCommand(kubectlCmd)
+
+	// kraken flags come before the kubectl arguments, so that kubectl flags such as -o and
+	// -c are not taken for kraken's
+	kubectlCmd.Flags().SetInterspersed(false)
 }
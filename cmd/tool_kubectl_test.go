@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestToolArgumentsArePreserved(t *testing.T) {
+	originalConfigPath := ClusterConfigPath
+	defer func() {
+		ClusterConfigPath = originalConfigPath
+		toolCmd.PersistentFlags().Lookup("config").Changed = false
+	}()
+
+	cases := []struct {
+		args     []string
+		expected []string
+	}{
+		{
+			[]string{"tool", "kubectl", "-c", "/tmp/config.yaml", "get", "pods", "-l", "app in (a, b)", "-o", "jsonpath={.items[*].metadata.name}"},
+			[]string{"get", "pods", "-l", "app in (a, b)", "-o", "jsonpath={.items[*].metadata.name}"},
+		},
+		{
+			[]string{"tool", "kubectl", "--config", "/tmp/config.yaml", "--", "-n", "kube-system", "logs", "dns", "-c", "kubedns"},
+			[]string{"-n", "kube-system", "logs", "dns", "-c", "kubedns"},
+		},
+		{
+			[]string{"tool", "kubectl", "-c", "/tmp/config.yaml", "exec", "-it", "pod", "--", "sh", "-c", "echo a b"},
+			[]string{"exec", "-it", "pod", "--", "sh", "-c", "echo a b"},
+		},
+		{
+			[]string{"tool", "exec", "-c", "/tmp/config.yaml", "--", "aws", "s3", "ls", "--profile", "ci"},
+			[]string{"aws", "s3", "ls", "--profile", "ci"},
+		},
+		{
+			[]string{"tool", "helm", "-c", "/tmp/config.yaml", "install", "atlas/kafka", "--set", "key=a b"},
+			[]string{"install", "atlas/kafka", "--set", "key=a b"},
+		},
+	}
+
+	for _, c := range cases {
+		ClusterConfigPath = ""
+		cmd, args, err := RootCmd.Find(c.args)
+		if err != nil {
+			t.Fatal("Expected the tool command to be found, got", err)
+		}
+
+		if err := cmd.ParseFlags(args); err != nil {
+			t.Fatal("Expected the flags to parse, got", err)
+		}
+
+		if got := cmd.Flags().Args(); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("Expected %s to get %q, got %q", cmd.Name(), c.expected, got)
+		}
+
+		if ClusterConfigPath != "/tmp/config.yaml" {
+			t.Error("Expected the kraken --config flag to be parsed, got", ClusterConfigPath)
+		}
+	}
+}
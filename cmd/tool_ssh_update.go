@@ -55,7 +55,7 @@ var sshUpdateCmd = &cobra.Command{
 			clusterHelp(HelpTypeCreated, ClusterConfigPath)
 		}
 
-		ExitCode, err = runKrakenLibCommand(spinnerPrefix, command, ClusterConfigPath, onFailure, onSuccess)
+		ExitCode, err = runKrakenLibCommand(actionSSHRefresh, spinnerPrefix, command, ClusterConfigPath, onFailure, onSuccess)
 		return err
 	},
 }
@@ -38,15 +38,23 @@ var versionCmd = &cobra.Command{
 	SilenceUsage:  true,
 	Long:          `Display cli version information`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		semVer, err := semver.Make(KrakenMajorMinorPatch + "-" + KrakenType + "+git.sha." + KrakenGitCommit)
+		semVer, err := semver.Make(cliVersion())
 		if err != nil {
 			ExitCode = -1
 			return err
 		}
 
 		if verbosity {
+			digest, err := imageDigestInUse()
+			if err != nil {
+				ExitCode = 1
+				return err
+			}
+
 			fmt.Printf("Kraken Commit: %s \n", KrakenGitCommit)
 			fmt.Printf("Kraken-lib Tag: %s \n", KrakenlibTag)
+			fmt.Printf("Kraken-lib Image: %s \n", containerImage)
+			fmt.Printf("Kraken-lib Digest: %s \n", digest)
 		}
 
 		fmt.Println(semVer.String())
@@ -55,6 +63,67 @@ var versionCmd = &cobra.Command{
 	},
 }
 
+// cliVersion is the semantic version of this kraken build.
+func cliVersion() string {
+	return KrakenMajorMinorPatch + "-" + KrakenType + "+git.sha." + KrakenGitCommit
+}
+
+// imageDigestInUse describes the digest of the kraken-lib image cluster commands run: the
+// one pinned for the cluster of --config, if any, or else the one of the local image.
+func imageDigestInUse() (string, error) {
+	if versionConfigPath == "" {
+		return localImageDigest() + " (local image)", nil
+	}
+
+	ClusterConfigPath = versionConfigPath
+	if err := preRunGetClusterConfig(nil, nil); err != nil {
+		return "", err
+	}
+
+	if err := useClusterImage(actionUpdate); err != nil {
+		return "", err
+	}
+
+	clusterName := getFirstClusterName()
+	pinned, err := readImageDigest(clusterName)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case pinned == "":
+		return fmt.Sprintf("%s (local image, nothing pinned for cluster '%s')", localImageDigest(), clusterName), nil
+	case pinned == containerImage:
+		return fmt.Sprintf("%s (pinned for cluster '%s')", pinned, clusterName), nil
+	default:
+		return fmt.Sprintf("%s (local image, cluster '%s' is pinned to %s)", localImageDigest(), clusterName, pinned), nil
+	}
+}
+
+// localImageDigest describes the digest of the local kraken-lib image, or why it is unknown.
+func localImageDigest() string {
+	rt, err := newContainerRuntime()
+	if err != nil {
+		return fmt.Sprintf("unknown (%s)", err)
+	}
+
+	digest, err := imageDigest(getContext(), rt, containerImage)
+	if err != nil {
+		return fmt.Sprintf("unknown (%s)", err)
+	}
+
+	return digest
+}
+
+var versionConfigPath string
+
 func init() {
 	RootCmd.AddCommand(versionCmd)
+
+	versionCmd.Flags().StringVarP(
+		&versionConfigPath,
+		"config",
+		"c",
+		"",
+		"path to a kraken cluster config, to show the kraken-lib digest pinned for its cluster with --verbose")
 }